@@ -0,0 +1,490 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrusagent "github.com/tengattack/logrus-agent-hook"
+)
+
+const (
+	agentDialTimeout  = 5 * time.Second
+	agentWriteTimeout = 5 * time.Second
+	agentMaxBackoff   = 30 * time.Second
+)
+
+// AgentHook is a logrus hook which formats the entries and queues them in a
+// buffered channel, the queued entries are written to the log agent
+// (logstash) in order, and the entries overflowing the channel go to the
+// spool if any
+type AgentHook struct {
+	transport agentTransport
+	formatter logrus.Formatter
+	spool     *Spool
+
+	mu      sync.RWMutex
+	closed  bool
+	ch      chan []byte
+	abort   chan struct{}
+	done    chan struct{}
+	failing bool
+
+	enqueued   uint64
+	spooled    uint64
+	sent       uint64
+	dropped    uint64
+	reconnects uint64
+	lastWarn   int64
+	errMu      sync.Mutex
+	lastErr    string
+}
+
+// agentTransport writes the formatted entries to the agent synchronously
+type agentTransport interface {
+	write(b []byte) error
+	close() error
+}
+
+// netTransport writes the entries to the agent connection, the connection
+// is dialed on the first write and after failing to write
+type netTransport struct {
+	network string
+	address string
+	conn    net.Conn
+}
+
+// hookTransport fires the entries to the hook with the message as the entry
+// formatted already
+type hookTransport struct {
+	hook logrus.Hook
+}
+
+var (
+	// AgentFormatter creates the formatter for the agent hook with the fields
+	// always sent, it is replaced by the logger package
+	AgentFormatter = func(fields logrus.Fields) logrus.Formatter {
+		return logrusagent.DefaultFormatter(fields)
+	}
+
+	agentMu sync.Mutex
+	// agentHook is the agent hook of current config shared by loggers
+	agentHook *AgentHook
+	// agentHooks are all the agent hooks not closed yet
+	agentHooks []*AgentHook
+
+	// agentEntryLogger is the logger of the entries fired to the log agent
+	// hook, the entries are formatted already
+	agentEntryLogger = &logrus.Logger{
+		Out:       io.Discard,
+		Formatter: rawFormatter{},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.TraceLevel,
+	}
+)
+
+// rawFormatter returns the message of the entry as is, the message is the
+// entry formatted by AgentHook
+type rawFormatter struct{}
+
+// Format returns the message
+func (rawFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return []byte(entry.Message), nil
+}
+
+// NewAgentHook creates the agent hook sending to the dsn,
+// eg: tcp://127.0.0.1:5000, udp://127.0.0.1:5000 or unix:///var/run/agent.sock
+func NewAgentHook(dsn string, formatter logrus.Formatter, channelSize int) (*AgentHook, error) {
+	return NewSpooledAgentHook(dsn, formatter, channelSize, nil)
+}
+
+// NewSpooledAgentHook creates the agent hook with the spool taking the
+// entries when the channel is full or the agent is unreachable, the spooled
+// entries are replayed in order once the channel is drained.
+// The spool is not closed with the hook.
+func NewSpooledAgentHook(dsn string, formatter logrus.Formatter, channelSize int, spool *Spool) (*AgentHook, error) {
+	network, address, err := parseAgentDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newAgentHookTransport(&netTransport{network: network, address: address},
+		formatter, channelSize, spool), nil
+}
+
+// WrapAgentHook queues the entries for the hook sending them to the agent,
+// the hook is fired with the entries whose message is the entry formatted
+// by formatter, and it should write the message as is before returning, the
+// entry is counted as sent once the hook returns nil. The failed entries
+// are retried with backoff until the hook is closed.
+func WrapAgentHook(hook logrus.Hook, formatter logrus.Formatter, channelSize int, spool *Spool) *AgentHook {
+	return newAgentHookTransport(&hookTransport{hook: hook}, formatter, channelSize, spool)
+}
+
+func newAgentHookTransport(transport agentTransport, formatter logrus.Formatter, channelSize int, spool *Spool) *AgentHook {
+	h := &AgentHook{
+		transport: transport,
+		formatter: formatter,
+		spool:     spool,
+		ch:        make(chan []byte, channelSize),
+		abort:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// parseAgentDSN returns the network and address of the agent dsn
+func parseAgentDSN(dsn string) (network, address string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// the error contains the dsn with password
+		return "", "", fmt.Errorf("invalid agent dsn: %q", RedactDSN(dsn))
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		address = u.Host
+	case "unix", "unixgram":
+		address = u.Path
+	default:
+		return "", "", fmt.Errorf("unsupported agent network: %q", u.Scheme)
+	}
+	if address == "" {
+		return "", "", errors.New("empty agent address")
+	}
+	return u.Scheme, address, nil
+}
+
+// Levels returns all the levels
+func (h *AgentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire formats the entry and queues it for sending, the entry is dropped if
+// the channel and the spool are full or the hook is closed
+func (h *AgentHook) Fire(entry *logrus.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		h.drop()
+		return nil
+	}
+	// keep the order once the entries start to be spooled
+	if h.spool != nil && !h.spool.Empty() {
+		h.spoolEntry(b)
+		return nil
+	}
+	select {
+	case h.ch <- b:
+		atomic.AddUint64(&h.enqueued, 1)
+	default:
+		h.spoolEntry(b)
+	}
+	return nil
+}
+
+// spoolEntry appends the entry to the spool, it is dropped if there is no
+// spool or the spool is full
+func (h *AgentHook) spoolEntry(b []byte) {
+	if h.spool == nil || h.spool.Append(b) != nil {
+		h.drop()
+		return
+	}
+	atomic.AddUint64(&h.spooled, 1)
+}
+
+// Dropped returns the count of the entries dropped
+func (h *AgentHook) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Close stops accepting entries and waits for the queued entries to be
+// written to the agent until ctx is done, the entries still queued then are
+// put in front of the spooled ones or dropped, then the connection to the
+// agent is closed. The spooled entries are left to the next hook using the
+// spool.
+func (h *AgentHook) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.ch)
+	h.mu.Unlock()
+
+	var err error
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		close(h.abort)
+		<-h.done
+	}
+	if dropped := h.Dropped(); dropped > 0 {
+		if err != nil {
+			return fmt.Errorf("log agent dropped %d entries: %w", dropped, err)
+		}
+		return fmt.Errorf("log agent dropped %d entries", dropped)
+	}
+	return err
+}
+
+func (h *AgentHook) run() {
+	defer close(h.done)
+	defer h.transport.close()
+	if h.spool == nil {
+		for b := range h.ch {
+			if !h.send(b) {
+				h.drop()
+			}
+		}
+		return
+	}
+
+	// the notification may be taken by another hook sharing the spool
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		// the queued entries are older than the spooled ones
+		select {
+		case b, ok := <-h.ch:
+			if !ok {
+				return
+			}
+			if !h.send(b) {
+				h.requeue(b)
+				return
+			}
+			continue
+		default:
+		}
+		if ok, _ := h.spool.Shift(h.send); ok {
+			continue
+		}
+		select {
+		case b, ok := <-h.ch:
+			if !ok {
+				return
+			}
+			if !h.send(b) {
+				h.requeue(b)
+				return
+			}
+		case <-h.spool.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// requeue puts the entry failed to send when aborted and the entries left in
+// the closed channel in front of the spool, they are older than the spooled
+// ones
+func (h *AgentHook) requeue(b []byte) {
+	records := [][]byte{b}
+	for b := range h.ch {
+		records = append(records, b)
+	}
+	if err := h.spool.Prepend(records); err != nil {
+		for range records {
+			h.drop()
+		}
+		return
+	}
+	atomic.AddUint64(&h.spooled, uint64(len(records)))
+}
+
+// send writes the entry to the agent and retries with backoff on errors, it
+// only gives up when the hook is aborted
+func (h *AgentHook) send(b []byte) bool {
+	backoff := 100 * time.Millisecond
+	for {
+		select {
+		case <-h.abort:
+			return false
+		default:
+		}
+		err := h.transport.write(b)
+		if err == nil {
+			if h.failing {
+				// the agent is reachable again
+				atomic.AddUint64(&h.reconnects, 1)
+				h.failing = false
+			}
+			atomic.AddUint64(&h.sent, 1)
+			return true
+		}
+		h.setError(err)
+		h.failing = true
+		select {
+		case <-h.abort:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > agentMaxBackoff {
+			backoff = agentMaxBackoff
+		}
+	}
+}
+
+func (t *netTransport) write(b []byte) error {
+	if t.conn == nil {
+		conn, err := net.DialTimeout(t.network, t.address, agentDialTimeout)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	err := t.conn.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	if err == nil {
+		_, err = t.conn.Write(b)
+	}
+	if err != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	return err
+}
+
+func (t *netTransport) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *hookTransport) write(b []byte) error {
+	entry := logrus.NewEntry(agentEntryLogger)
+	entry.Time = time.Now()
+	entry.Message = string(b)
+	return t.hook.Fire(entry)
+}
+
+func (t *hookTransport) close() error {
+	return nil
+}
+
+// agentFields returns the fields always sent to the agent
+func agentFields(agent *AgentConfig) logrus.Fields {
+	fields := logrus.Fields{
+		"app_id":      agent.AppID,
+		"host":        agent.Host,
+		"instance_id": agent.InstanceID,
+	}
+	if agent.Category != "" {
+		fields["category"] = agent.Category
+	}
+	return fields
+}
+
+// getAgentHook returns the agent hook of current config, it is created on
+// the first call
+func getAgentHook() (*AgentHook, error) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+
+	if agentHook != nil {
+		return agentHook, nil
+	}
+	hook, err := newAgentHook(&conf.Agent)
+	if err != nil {
+		return nil, err
+	}
+	agentHook = hook
+	agentHooks = append(agentHooks, hook)
+	publishAgentStats()
+	return hook, nil
+}
+
+// newAgentHook creates the agent hook of the agent config
+func newAgentHook(agent *AgentConfig) (*AgentHook, error) {
+	var spool *Spool
+	if agent.SpoolDir != "" {
+		var err error
+		spool, err = openSpool(agent.SpoolDir, agent.spoolOptions())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewSpooledAgentHook(agent.DSN,
+		AgentFormatter(agentFields(agent)), agent.ChannelSize, spool)
+}
+
+// resetAgentHook makes the next getAgentHook call create a new hook
+func resetAgentHook() {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	agentHook = nil
+}
+
+// addHook adds the hook to the logger if it is not added yet
+func addHook(log *logrus.Logger, hook logrus.Hook) {
+	for _, level := range hook.Levels() {
+		for _, h := range log.Hooks[level] {
+			if h == hook {
+				return
+			}
+		}
+	}
+	log.AddHook(hook)
+}
+
+// Close waits for the agent hooks to send the queued entries until ctx is
+// done, then closes the spools and syncs and closes the log files, the
+// returned error reports the entries dropped
+func Close(ctx context.Context) error {
+	agentMu.Lock()
+	hooks := agentHooks
+	agentHooks = nil
+	agentHook = nil
+	agentMu.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	spoolsMu.Lock()
+	for dir, s := range spools {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(spools, dir)
+	}
+	spoolsMu.Unlock()
+
+	closersMu.Lock()
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	closers = nil
+	closersMu.Unlock()
+
+	filesMu.Lock()
+	for filename, w := range files {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(files, filename)
+	}
+	filesMu.Unlock()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,270 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+// agentRecorder is the log agent hook recording the messages, it fails
+// while it is down
+type agentRecorder struct {
+	mu   sync.Mutex
+	down bool
+	msgs []string
+}
+
+func (r *agentRecorder) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *agentRecorder) Fire(entry *logrus.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return errors.New("agent is down")
+	}
+	r.msgs = append(r.msgs, strings.TrimSuffix(entry.Message, "\n"))
+	return nil
+}
+
+func (r *agentRecorder) setDown(down bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.down = down
+}
+
+func (r *agentRecorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.msgs...)
+}
+
+func TestAgentHookClose(t *testing.T) {
+	assert := assert.New(t)
+	agent := &agentRecorder{}
+	hook := log.WrapAgentHook(agent, &logrus.TextFormatter{DisableTimestamp: true}, 100, nil)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 10; i++ {
+		l.Info("agent")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(hook.Close(ctx))
+	msgs := agent.messages()
+	assert.Len(msgs, 10)
+	assert.Equal(`level=info msg=agent`, msgs[0])
+
+	// entries after closing are dropped
+	l.Info("agent")
+	assert.EqualValues(1, hook.Dropped())
+}
+
+func TestAgentHookNetwork(t *testing.T) {
+	assert := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer ln.Close()
+
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	hook, err := log.NewAgentHook("tcp://"+ln.Addr().String(), &logrus.JSONFormatter{}, 100)
+	assert.NoError(err)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 10; i++ {
+		l.Info("agent")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(hook.Close(ctx))
+	assert.EqualValues(10, hook.Stats().Sent)
+
+	// the connection is closed with the hook
+	var n int
+	for range lines {
+		n++
+	}
+	assert.Equal(10, n)
+}
+
+func TestAgentHookCloseTimeout(t *testing.T) {
+	assert := assert.New(t)
+	agent := &agentRecorder{down: true}
+	hook := log.WrapAgentHook(agent, &logrus.JSONFormatter{}, 100, nil)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 3; i++ {
+		l.Info("agent")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := hook.Close(ctx)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.EqualValues(3, hook.Dropped())
+	assert.Empty(agent.messages())
+
+	_, err = log.NewAgentHook("http://127.0.0.1:5000", &logrus.JSONFormatter{}, 100)
+	assert.Error(err)
+}
+
+func TestAgentHookStats(t *testing.T) {
+	assert := assert.New(t)
+	var warnings bytes.Buffer
+	output := log.AgentWarnOutput
+	log.AgentWarnOutput = &warnings
+	defer func() { log.AgentWarnOutput = output }()
+
+	agent := &agentRecorder{down: true}
+	hook := log.WrapAgentHook(agent, &logrus.JSONFormatter{}, 2, nil)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 5; i++ {
+		l.Error("agent")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = hook.Close(ctx)
+	}()
+
+	stats := hook.Stats()
+	assert.EqualValues(5, stats.Enqueued+stats.Dropped)
+	assert.GreaterOrEqual(stats.Dropped, uint64(2))
+	assert.Zero(stats.Sent)
+	assert.Equal(2, stats.QueueSize)
+	assert.LessOrEqual(stats.QueueDepth, 2)
+	assert.Eventually(func() bool {
+		return hook.Stats().LastError == "agent is down"
+	}, time.Second, 10*time.Millisecond)
+
+	// the warning is rate limited
+	assert.Equal(1, strings.Count(warnings.String(), "log agent dropped"))
+	assert.Contains(warnings.String(), "queue 2/2")
+
+	// the agent recovers
+	agent.setDown(false)
+	assert.Eventually(func() bool {
+		return hook.Stats().Sent > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(1, hook.Stats().Reconnects)
+}
+
+func TestAgentHookStatsNetwork(t *testing.T) {
+	assert := assert.New(t)
+	var warnings bytes.Buffer
+	output := log.AgentWarnOutput
+	log.AgentWarnOutput = &warnings
+	defer func() { log.AgentWarnOutput = output }()
+
+	// nothing listens on the address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	hook, err := log.NewAgentHook("tcp://"+addr, &logrus.JSONFormatter{}, 100)
+	assert.NoError(err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = hook.Close(ctx)
+	}()
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	l.Info("agent")
+	assert.Eventually(func() bool {
+		return strings.Contains(hook.Stats().LastError, "connection refused")
+	}, time.Second, 10*time.Millisecond)
+	assert.Zero(hook.Stats().Sent)
+
+	// the entry is sent once the agent is up
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("the address is taken:", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+	assert.Eventually(func() bool {
+		return hook.Stats().Sent == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(1, hook.Stats().Reconnects)
+}
+
+func TestGetAgentStats(t *testing.T) {
+	assert := assert.New(t)
+	conf := newTestConfig()
+	conf.AccessLog = ""
+	conf.Agent.Enabled = true
+	conf.Agent.DSN = "tcp://127.0.0.1:5000"
+	conf.Agent.ChannelSize = 2
+	assert.NoError(log.InitLog(conf))
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = log.Close(ctx)
+	}()
+
+	assert.Equal(2, log.GetAgentStats().QueueSize)
+	assert.Contains(expvar.Get("log_agent").String(), `"queue_size":2`)
+}
+
+func TestAgentHookStatsSent(t *testing.T) {
+	assert := assert.New(t)
+	agent := &agentRecorder{}
+	hook := log.WrapAgentHook(agent, &logrus.JSONFormatter{}, 100, nil)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 10; i++ {
+		l.Info("agent")
+	}
+	assert.NoError(hook.Close(context.Background()))
+
+	stats := hook.Stats()
+	assert.EqualValues(10, stats.Enqueued)
+	assert.EqualValues(10, stats.Sent)
+	assert.Zero(stats.Dropped)
+	assert.Zero(stats.Reconnects)
+	assert.Empty(stats.LastError)
+	assert.Equal(100, stats.QueueSize)
+}
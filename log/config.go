@@ -0,0 +1,196 @@
+package log
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the config
+const EnvPrefix = "TGO_LOG_"
+
+// configField is a scalar field of the config addressed by its yaml path
+type configField struct {
+	path  string
+	value reflect.Value
+}
+
+var (
+	overridesMu sync.Mutex
+	// overrides stores the values set by the flags by config and yaml path,
+	// they are applied again to the config reloaded by WatchConfig
+	overrides = map[*Config]map[string]string{}
+)
+
+// LoadConfig loads the config with the precedence from low to high:
+//  1. DefaultConfig
+//  2. the yaml file at path, it is skipped if path is empty
+//  3. the environment variables named by EnvPrefix and the upper-cased yaml
+//     path with dots replaced by underscores, eg: TGO_LOG_ERROR_LEVEL and
+//     TGO_LOG_AGENT_DSN
+//
+// The command-line flags registered by RegisterFlags on the returned config
+// take the highest precedence as they are parsed after loading.
+// The list fields are comma separated in environment variables and flags.
+func LoadConfig(path string) (*Config, error) {
+	c := *DefaultConfig
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err = dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse log config %s: %v", path, err)
+		}
+	}
+	for _, field := range configFields(&c) {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(field.path, ".", "_"))
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setConfigField(field.value, s); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return &c, nil
+}
+
+// RegisterFlags registers the flags overriding the config to fs, the flags
+// are named log and the yaml path, eg: -log.error_level and -log.agent.dsn
+func RegisterFlags(fs *flag.FlagSet, conf *Config) {
+	for _, field := range configFields(conf) {
+		fs.Var(&configFlag{conf: conf, path: field.path, value: field.value}, "log."+field.path, "log config "+field.path)
+	}
+}
+
+// configFlag is the flag.Value setting a config field
+type configFlag struct {
+	conf  *Config
+	path  string
+	value reflect.Value
+}
+
+// String returns the field value
+func (f *configFlag) String() string {
+	if !f.value.IsValid() {
+		return ""
+	}
+	if f.value.Kind() == reflect.Slice {
+		return strings.Join(f.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// Set sets the field value
+func (f *configFlag) Set(s string) error {
+	if err := setConfigField(f.value, s); err != nil {
+		return err
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if overrides[f.conf] == nil {
+		overrides[f.conf] = map[string]string{}
+	}
+	overrides[f.conf][f.path] = s
+	return nil
+}
+
+// applyOverrides sets the values set by the flags of the config from to the
+// config to, so they still take precedence after reloading
+func applyOverrides(from, to *Config) error {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	values := overrides[from]
+	if len(values) == 0 {
+		return nil
+	}
+	for _, field := range configFields(to) {
+		if s, ok := values[field.path]; ok {
+			if err := setConfigField(field.value, s); err != nil {
+				return fmt.Errorf("invalid -log.%s: %v", field.path, err)
+			}
+		}
+	}
+	overrides[to] = values
+	return nil
+}
+
+// IsBoolFlag makes the bool fields work as bool flags, eg: -log.agent.enabled
+func (f *configFlag) IsBoolFlag() bool {
+	return f.value.Kind() == reflect.Bool
+}
+
+// configFields returns the scalar and string list fields of the config
+func configFields(conf *Config) []configField {
+	return appendConfigFields(nil, "", reflect.ValueOf(conf).Elem())
+}
+
+func appendConfigFields(fields []configField, prefix string, v reflect.Value) []configField {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fv := v.Field(i)
+		switch sf.Type.Kind() {
+		case reflect.Struct:
+			fields = appendConfigFields(fields, prefix+name+".", fv)
+		case reflect.String, reflect.Int, reflect.Bool:
+			fields = append(fields, configField{path: prefix + name, value: fv})
+		case reflect.Slice:
+			if sf.Type.Elem().Kind() == reflect.String {
+				fields = append(fields, configField{path: prefix + name, value: fv})
+			}
+		}
+	}
+	return fields
+}
+
+// setConfigField parses s into the field
+func setConfigField(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package log_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "log.yml")
+	assert.NoError(os.WriteFile(path, []byte(`
+format: json
+error_level: warn
+max_size: 100
+agent:
+  dsn: tcp://127.0.0.1:5000
+  app_id: tgo
+`), 0644))
+
+	// default < yaml
+	conf, err := log.LoadConfig(path)
+	assert.NoError(err)
+	assert.Equal("json", conf.Format)
+	assert.Equal(log.DefaultConfig.AccessLog, conf.AccessLog)
+	assert.Equal(log.DefaultConfig.AccessLevel, conf.AccessLevel)
+	assert.Equal("warn", conf.ErrorLevel)
+	assert.Equal(100, conf.MaxSize)
+	assert.Equal("tcp://127.0.0.1:5000", conf.Agent.DSN)
+	assert.False(conf.Agent.Enabled)
+
+	// yaml < env
+	t.Setenv("TGO_LOG_ERROR_LEVEL", "debug")
+	t.Setenv("TGO_LOG_AGENT_DSN", "udp://127.0.0.1:5001")
+	t.Setenv("TGO_LOG_AGENT_CHANNEL_SIZE", "10")
+	t.Setenv("TGO_LOG_REDACT_FIELDS", "password, token")
+	conf, err = log.LoadConfig(path)
+	assert.NoError(err)
+	assert.Equal("debug", conf.ErrorLevel)
+	assert.Equal("udp://127.0.0.1:5001", conf.Agent.DSN)
+	assert.Equal("tgo", conf.Agent.AppID)
+	assert.Equal(10, conf.Agent.ChannelSize)
+	assert.Equal([]string{"password", "token"}, conf.Redact.Fields)
+
+	// env < flags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	log.RegisterFlags(fs, conf)
+	assert.NoError(fs.Parse([]string{"-log.error_level=info", "-log.agent.enabled", "-log.max_size", "10"}))
+	assert.Equal("info", conf.ErrorLevel)
+	assert.True(conf.Agent.Enabled)
+	assert.Equal(10, conf.MaxSize)
+	assert.Equal("udp://127.0.0.1:5001", conf.Agent.DSN)
+	assert.Equal("info", fs.Lookup("log.error_level").Value.String())
+	assert.Equal("password,token", fs.Lookup("log.redact.fields").Value.String())
+
+	// defaults and env without file
+	conf, err = log.LoadConfig("")
+	assert.NoError(err)
+	assert.Equal(log.DefaultConfig.Format, conf.Format)
+	assert.Equal("debug", conf.ErrorLevel)
+
+	t.Setenv("TGO_LOG_MAX_SIZE", "foo")
+	_, err = log.LoadConfig(path)
+	assert.EqualError(err, `invalid TGO_LOG_MAX_SIZE: strconv.Atoi: parsing "foo": invalid syntax`)
+
+	assert.NoError(os.WriteFile(path, []byte("error_levle: warn\n"), 0644))
+	_, err = log.LoadConfig(path)
+	assert.Error(err)
+	_, err = log.LoadConfig(filepath.Join(t.TempDir(), "none.yml"))
+	assert.Error(err)
+}
@@ -0,0 +1,190 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// log formats
+const (
+	FormatString = "string"
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+var (
+	// EntryCaller returns the caller file and line of the entry for the
+	// outputs formatting the entries themselves, it is replaced by the
+	// logger package to return the caller set by SetCallFrame
+	EntryCaller = func(entry *logrus.Entry) (file string, line int, ok bool) {
+		if entry.Caller == nil {
+			return "", 0, false
+		}
+		return entry.Caller.File, entry.Caller.Line, true
+	}
+	// EntryFields returns the fields of the entry to log for the outputs
+	// formatting the entries themselves, it is replaced by the logger package
+	// to include the fields extracted from the entry context
+	EntryFields = func(entry *logrus.Entry) logrus.Fields {
+		return EntryRedactor(entry).RedactFields(entry.Data)
+	}
+
+	formattersMu sync.RWMutex
+	formatters   = map[string]func() logrus.Formatter{
+		FormatString: newTextFormatter,
+		FormatText:   newTextFormatter,
+		FormatJSON: func() logrus.Formatter {
+			return &logrus.JSONFormatter{}
+		},
+		FormatLogfmt: func() logrus.Formatter {
+			return &LogfmtFormatter{TimestampFormat: time.RFC3339}
+		},
+	}
+)
+
+// LogfmtFormatter defines the logfmt format of the entries with the caller
+// and fields returned by EntryCaller and EntryFields
+// eg: time=2019-01-31T04:48:20Z level=info caller=main.go:9 msg=foo key=value
+type LogfmtFormatter struct {
+	TimestampFormat string
+	DisableSorting  bool
+}
+
+func newTextFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{
+		TimestampFormat: "2006/01/02 - 15:04:05",
+		FullTimestamp:   true,
+	}
+}
+
+// RegisterFormatter makes a formatter available by the format name, it
+// replaces the formatter registered with the same name
+func RegisterFormatter(format string, newFormatter func() logrus.Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[format] = newFormatter
+}
+
+// NewFormatter returns a new formatter of the format, empty format is the
+// same as FormatString
+func NewFormatter(format string) (logrus.Formatter, error) {
+	if format == "" {
+		format = FormatString
+	}
+	formattersMu.RLock()
+	newFormatter, ok := formatters[format]
+	formattersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown log format: %q", format)
+	}
+	return newFormatter(), nil
+}
+
+// Format renders a single log entry as a logfmt line
+func (f *LogfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := EntryFields(entry)
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	if !f.DisableSorting {
+		sort.Strings(keys)
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339
+	}
+
+	var b *bytes.Buffer
+	if entry.Buffer != nil {
+		b = entry.Buffer
+	} else {
+		b = &bytes.Buffer{}
+	}
+	AppendLogfmt(b, "time", entry.Time.Format(timestampFormat))
+	AppendLogfmt(b, "level", entry.Level.String())
+	if file, line, ok := EntryCaller(entry); ok {
+		AppendLogfmt(b, "caller", fmt.Sprintf("%s:%d", file, line))
+	}
+	AppendLogfmt(b, "msg", EntryRedactor(entry).RedactString(entry.Message))
+	for _, k := range keys {
+		AppendLogfmt(b, k, data[k])
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// AppendLogfmt appends the logfmt key value pair, the invalid characters in
+// key are replaced with underscore and the value is quoted if needed
+func AppendLogfmt(b *bytes.Buffer, key string, value interface{}) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('=')
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "null" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+	}) >= 0 {
+		appendLogfmtQuoted(b, s)
+	} else {
+		b.WriteString(s)
+	}
+}
+
+// appendLogfmtQuoted append the quoted string with backslash escapes
+func appendLogfmtQuoted(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < ' ':
+			b.WriteString(`\u00`)
+			b.WriteByte(hex[r>>4])
+			b.WriteByte(hex[r&0xF])
+		case r == utf8.RuneError:
+			b.WriteString(`\ufffd`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+}
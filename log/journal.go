@@ -0,0 +1,137 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JournalSocket is the default socket of systemd-journald native protocol
+const JournalSocket = "/run/systemd/journal/socket"
+
+// JournalFormatter formats the entry with the systemd-journald native
+// protocol, the fields are upper-cased journal fields and the caller is
+// logged as CODE_FILE and CODE_LINE
+type JournalFormatter struct {
+	SyslogIdentifier string
+}
+
+// journalFields are the fields set by JournalFormatter
+var journalFields = map[string]struct{}{
+	"MESSAGE":           {},
+	"PRIORITY":          {},
+	"SYSLOG_IDENTIFIER": {},
+	"CODE_FILE":         {},
+	"CODE_LINE":         {},
+}
+
+// NewJournalOutput creates the journal writer and formatter by the output,
+// eg: journal or journal:///run/systemd/journal/socket
+func NewJournalOutput(output string) (*JournalWriter, *JournalFormatter, error) {
+	return newJournalOutput(conf, output)
+}
+
+func newJournalOutput(c *Config, output string) (*JournalWriter, *JournalFormatter, error) {
+	socket := JournalSocket
+	if output != "journal" {
+		u, err := url.Parse(output)
+		if err != nil {
+			return nil, nil, err
+		}
+		if u.Path != "" {
+			socket = u.Path
+		}
+	}
+	w, err := NewJournalWriter(socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &JournalFormatter{}
+	if c != nil {
+		f.SyslogIdentifier = c.Agent.AppID
+	}
+	if f.SyslogIdentifier == "" {
+		f.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+	return w, f, nil
+}
+
+// Format renders the entry as a journal datagram
+func (f *JournalFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b := &bytes.Buffer{}
+	appendJournalField(b, "MESSAGE", EntryRedactor(entry).RedactString(entry.Message))
+	appendJournalField(b, "PRIORITY", strconv.Itoa(syslogSeverity(entry.Level)))
+	if f.SyslogIdentifier != "" {
+		appendJournalField(b, "SYSLOG_IDENTIFIER", f.SyslogIdentifier)
+	}
+	if file, line, ok := EntryCaller(entry); ok {
+		appendJournalField(b, "CODE_FILE", file)
+		appendJournalField(b, "CODE_LINE", strconv.Itoa(line))
+	}
+	for k, v := range EntryFields(entry) {
+		key := journalFieldName(k)
+		if _, ok := journalFields[key]; ok {
+			key = "FIELD_" + key
+		}
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case error:
+			value = v.Error()
+		default:
+			value = fmt.Sprint(v)
+		}
+		appendJournalField(b, key, value)
+	}
+	return b.Bytes(), nil
+}
+
+// appendJournalField appends the field as KEY=value, or the binary safe
+// KEY, little-endian 64 bit length and value if value contains newline
+func appendJournalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+	} else {
+		b.WriteByte('\n')
+		_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	}
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName returns the valid journal field name of the key, which
+// contains only upper case letters, digits and underscores, and not starts
+// with underscore or digit
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// isJournalOutput checks whether the output is the journal
+func isJournalOutput(output string) bool {
+	return output == "journal" || strings.HasPrefix(output, "journal://")
+}
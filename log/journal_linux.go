@@ -0,0 +1,72 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// JournalWriter sends each write as a journal datagram, the datagram too
+// large for the socket is sent by a sealed memfd
+type JournalWriter struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// NewJournalWriter creates the writer to the journal socket
+func NewJournalWriter(socket string) (*JournalWriter, error) {
+	if _, err := os.Stat(socket); err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWriter{
+		conn: conn,
+		addr: &net.UnixAddr{Name: socket, Net: "unixgram"},
+	}, nil
+}
+
+// Write sends the datagram
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	_, _, err := w.conn.WriteMsgUnix(p, nil, w.addr)
+	if err == nil {
+		return len(p), nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return 0, err
+	}
+	if err = w.writeMemfd(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeMemfd sends the datagram by passing a sealed memfd contains it
+func (w *JournalWriter) writeMemfd(p []byte) error {
+	fd, err := unix.MemfdCreate("journal-message", unix.MFD_ALLOW_SEALING|unix.MFD_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "journal-message")
+	defer f.Close()
+	if _, err = f.Write(p); err != nil {
+		return err
+	}
+	_, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS,
+		unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL)
+	if err != nil {
+		return err
+	}
+	_, _, err = w.conn.WriteMsgUnix(nil, unix.UnixRights(int(f.Fd())), w.addr)
+	return err
+}
+
+// Close closes the socket
+func (w *JournalWriter) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package log
+
+import "errors"
+
+// JournalWriter is only supported on linux
+type JournalWriter struct{}
+
+// NewJournalWriter returns error as journal is only supported on linux
+func NewJournalWriter(socket string) (*JournalWriter, error) {
+	return nil, errors.New("journal is only supported on linux")
+}
+
+// Write does nothing
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("journal is only supported on linux")
+}
+
+// Close does nothing
+func (w *JournalWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package log_test
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"golang.org/x/sys/unix"
+)
+
+// parseJournal decodes the fields of the journal datagram
+func parseJournal(t *testing.T, b []byte) map[string]string {
+	fields := map[string]string{}
+	for len(b) > 0 {
+		i := strings.IndexAny(string(b), "=\n")
+		if i < 0 {
+			t.Fatalf("invalid journal datagram: %q", b)
+		}
+		key := string(b[:i])
+		if b[i] == '=' {
+			b = b[i+1:]
+			j := strings.IndexByte(string(b), '\n')
+			fields[key] = string(b[:j])
+			b = b[j+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(b[i+1 : i+9])
+		b = b[i+9:]
+		fields[key] = string(b[:n])
+		b = b[n+1:]
+	}
+	return fields
+}
+
+func TestJournalOutput(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn := listenUnixgram(t, path)
+	defer conn.Close()
+
+	conf := newTestConfig()
+	conf.ErrorLog = "journal://" + path
+	conf.Agent.AppID = "tgo"
+	assert.NoError(log.InitLog(conf))
+
+	log.LogError.WithFields(logrus.Fields{
+		"user-id":  1,
+		"_private": "foo",
+		"message":  "bar",
+		"multi":    "a\nb",
+	}).Error("foo")
+	fields := parseJournal(t, []byte(readDatagram(t, conn)))
+	assert.Equal(map[string]string{
+		"MESSAGE":           "foo",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "tgo",
+		"USER_ID":           "1",
+		"PRIVATE":           "foo",
+		"FIELD_MESSAGE":     "bar",
+		"MULTI":             "a\nb",
+	}, fields)
+
+	_, _, err := log.NewJournalOutput("journal://" + filepath.Join(t.TempDir(), "none.sock"))
+	assert.Error(err)
+}
+
+func TestJournalMemfd(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn := listenUnixgram(t, path)
+	defer conn.Close()
+
+	w, f, err := log.NewJournalOutput("journal://" + path)
+	assert.NoError(err)
+	defer w.Close()
+	l := logrus.New()
+	l.Out, l.Formatter = w, f
+	message := strings.Repeat("x", 1<<20)
+	l.Info(message)
+
+	// the large entry is sent as an empty datagram with the memfd
+	buf := make([]byte, 16)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	assert.NoError(err)
+	assert.Equal(0, n)
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	assert.NoError(err)
+	assert.Len(msgs, 1)
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	assert.NoError(err)
+	assert.Len(fds, 1)
+
+	file := os.NewFile(uintptr(fds[0]), "journal-message")
+	defer file.Close()
+	// the memfd shares the offset with the sender which is at the end
+	b, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<30))
+	assert.NoError(err)
+	fields := parseJournal(t, b)
+	assert.True(fields["MESSAGE"] == message)
+	assert.Equal("6", fields["PRIORITY"])
+}
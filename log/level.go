@@ -0,0 +1,178 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Levels is the levels of LogAccess and LogError
+type Levels struct {
+	AccessLevel string `json:"access_level,omitempty"`
+	ErrorLevel  string `json:"error_level,omitempty"`
+}
+
+// levelRequest is the request body to set levels
+type levelRequest struct {
+	Levels
+	// TTL is the duration to revert the levels, eg: 10m
+	TTL string `json:"ttl,omitempty"`
+}
+
+// levelOverride saves the levels overridden temporarily
+type levelOverride struct {
+	access      *logrus.Logger
+	error       *logrus.Logger
+	accessLevel logrus.Level
+	errorLevel  logrus.Level
+	timer       *time.Timer
+}
+
+var (
+	levelMu  sync.Mutex
+	override *levelOverride
+)
+
+// GetLevels returns the current levels of LogAccess and LogError
+func GetLevels() Levels {
+	var levels Levels
+	if LogAccess != nil {
+		levels.AccessLevel = getLevel(LogAccess).String()
+	}
+	if LogError != nil {
+		levels.ErrorLevel = getLevel(LogError).String()
+	}
+	return levels
+}
+
+// SetLevels sets the levels of LogAccess and LogError, empty level keeps it
+// unchanged, the levels are reverted after ttl if ttl is positive
+func SetLevels(levels Levels, ttl time.Duration) error {
+	return setLevels(levels, ttl, ttl > 0)
+}
+
+// RestoreLevels reverts the levels overridden temporarily
+func RestoreLevels() {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	restoreLevels()
+}
+
+func setLevels(levels Levels, ttl time.Duration, temporary bool) error {
+	var accessLevel, errorLevel logrus.Level
+	var err error
+	if levels.AccessLevel != "" {
+		if accessLevel, err = logrus.ParseLevel(levels.AccessLevel); err != nil {
+			return err
+		}
+	}
+	if levels.ErrorLevel != "" {
+		if errorLevel, err = logrus.ParseLevel(levels.ErrorLevel); err != nil {
+			return err
+		}
+	}
+	if LogAccess == nil || LogError == nil {
+		return errors.New("log is not initialized")
+	}
+
+	levelMu.Lock()
+	defer levelMu.Unlock()
+
+	if override != nil && override.timer != nil {
+		override.timer.Stop()
+		override.timer = nil
+	}
+	if !temporary {
+		override = nil
+	} else if override == nil {
+		override = &levelOverride{
+			access:      LogAccess,
+			error:       LogError,
+			accessLevel: getLevel(LogAccess),
+			errorLevel:  getLevel(LogError),
+		}
+	}
+	if levels.AccessLevel != "" {
+		setLevel(LogAccess, accessLevel)
+	}
+	if levels.ErrorLevel != "" {
+		setLevel(LogError, errorLevel)
+	}
+	if temporary && ttl > 0 {
+		o := override
+		o.timer = time.AfterFunc(ttl, func() {
+			levelMu.Lock()
+			defer levelMu.Unlock()
+			if override == o {
+				restoreLevels()
+			}
+		})
+	}
+	return nil
+}
+
+func restoreLevels() {
+	if override == nil {
+		return
+	}
+	if override.timer != nil {
+		override.timer.Stop()
+	}
+	setLevel(override.access, override.accessLevel)
+	setLevel(override.error, override.errorLevel)
+	override = nil
+}
+
+// resetLevels discards the levels overridden temporarily
+func resetLevels() {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if override != nil && override.timer != nil {
+		override.timer.Stop()
+	}
+	override = nil
+}
+
+// LevelHandler returns the http handler to get the levels by GET and set the
+// levels by PUT with the JSON body, eg: {"access_level":"debug","ttl":"10m"}
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req levelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err)
+				return
+			}
+			var ttl time.Duration
+			if req.TTL != "" {
+				var err error
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					writeLevelError(w, http.StatusBadRequest, err)
+					return
+				}
+			}
+			if err := SetLevels(req.Levels, ttl); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeLevelError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(GetLevels())
+	})
+}
+
+func writeLevelError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
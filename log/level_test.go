@@ -0,0 +1,120 @@
+package log_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func TestLevelHandler(t *testing.T) {
+	assert := assert.New(t)
+	conf := *log.DefaultConfig
+	conf.AccessLevel = "info"
+	conf.ErrorLevel = "error"
+	assert.NoError(log.InitLog(&conf))
+	h := log.LevelHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"access_level":"info","error_level":"error"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log/level",
+		strings.NewReader(`{"access_level":"debug","ttl":"50ms"}`)))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"access_level":"debug","error_level":"error"}`, w.Body.String())
+	assert.Equal(logrus.DebugLevel, log.LogAccess.GetLevel())
+	assert.Eventually(func() bool {
+		return log.LogAccess.GetLevel() == logrus.InfoLevel
+	}, time.Second, 10*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log/level",
+		strings.NewReader(`{"error_level":"invalid"}`)))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal("not a valid logrus Level: \"invalid\"", resp["error"])
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/log/level", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestRestoreLevels(t *testing.T) {
+	assert := assert.New(t)
+	conf := *log.DefaultConfig
+	conf.AccessLevel = "info"
+	conf.ErrorLevel = "error"
+	assert.NoError(log.InitLog(&conf))
+
+	assert.NoError(log.SetLevels(log.Levels{AccessLevel: "debug", ErrorLevel: "debug"}, time.Hour))
+	assert.Equal(logrus.DebugLevel, log.LogError.GetLevel())
+	log.RestoreLevels()
+	assert.Equal(logrus.InfoLevel, log.LogAccess.GetLevel())
+	assert.Equal(logrus.ErrorLevel, log.LogError.GetLevel())
+
+	// permanent change
+	assert.NoError(log.SetLevels(log.Levels{AccessLevel: "warn"}, 0))
+	log.RestoreLevels()
+	assert.Equal(logrus.WarnLevel, log.LogAccess.GetLevel())
+}
+
+func TestVModule(t *testing.T) {
+	assert := assert.New(t)
+	conf := *log.DefaultConfig
+	conf.AccessLevel = "info"
+	conf.ErrorLevel = "error"
+	conf.AccessLog = filepath.Join(t.TempDir(), "access.log")
+	conf.VModule = "controllers/payment/*=debug,models/*=warn,util=debug,service/*/...=debug"
+	assert.NoError(log.InitLog(&conf))
+	defer func() {
+		assert.NoError(log.SetVModule(""))
+	}()
+
+	// lowered to the most verbose level of the rules
+	assert.Equal(logrus.DebugLevel, log.LogAccess.GetLevel())
+	assert.Equal("info", log.GetLevels().AccessLevel)
+
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "controllers/payment/order.go"))
+	assert.False(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "controllers/user/order.go"))
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.InfoLevel, "controllers/user/order.go"))
+	assert.False(log.LevelEnabled(log.LogAccess, logrus.InfoLevel, "models/user.go"))
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.WarnLevel, "models/user.go"))
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "service/util.go"))
+	// cached result
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "controllers/payment/order.go"))
+	// the nested packages
+	assert.False(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "controllers/payment/alipay/notify.go"))
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "service/payment/alipay/notify.go"))
+	assert.True(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "service/payment/notify.go"))
+	assert.False(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "service/notify.go"))
+
+	// the entries logged directly without the caller are filtered by the
+	// access level
+	log.LogAccess.Debug("direct debug")
+	log.LogAccess.Info("direct info")
+	b, err := os.ReadFile(conf.AccessLog)
+	assert.NoError(err)
+	assert.NotContains(string(b), "direct debug")
+	assert.Contains(string(b), "direct info")
+
+	assert.NoError(log.SetVModule(""))
+	assert.Equal(logrus.InfoLevel, log.LogAccess.GetLevel())
+	assert.False(log.LevelEnabled(log.LogAccess, logrus.DebugLevel, "controllers/payment/order.go"))
+
+	assert.Error(log.SetVModule("models/*"))
+	assert.Error(log.SetVModule("models/*=invalid"))
+	assert.Error(log.SetVModule("[=debug"))
+	assert.Error(log.SetVModule("[/...=debug"))
+}
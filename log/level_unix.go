@@ -0,0 +1,35 @@
+//go:build !windows
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DebugOnSignal sets the levels of LogAccess and LogError to debug on SIGUSR1
+// and restores them on SIGUSR2, call the returned function to stop it
+func DebugOnSignal() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if sig == syscall.SIGUSR1 {
+					_ = setLevels(Levels{AccessLevel: "debug", ErrorLevel: "debug"}, 0, true)
+				} else {
+					RestoreLevels()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -3,25 +3,45 @@ package log
 import (
 	"errors"
 	"io"
-	"net/url"
 	"os"
+	"sync"
 
 	"github.com/sirupsen/logrus"
-	logrusagent "github.com/tengattack/logrus-agent-hook"
 	"golang.org/x/term"
 )
 
 // Config is logging config.
+// MaxSize is in megabytes and MaxAge is in days, Rotate is the time based
+// rotation period of log files: daily or hourly.
+// VModule is the level rules by caller file, see SetVModule.
+// Outputs are the additional outputs of the streams, AccessLog and ErrorLog
+// are the shorthand of the access and error stream output.
+// Metrics counts the entries and the bytes written, see MetricsHandler.
+// StackLevel is the minimum level of the entries capturing the stack of the
+// caller, eg: error, the stack is not captured if it is empty. StackDepth is
+// the maximum number of the frames captured, DefaultStackDepth if zero.
 type Config struct {
-	Format      string      `yaml:"format"`
-	AccessLog   string      `yaml:"access_log"`
-	AccessLevel string      `yaml:"access_level"`
-	ErrorLog    string      `yaml:"error_log"`
-	ErrorLevel  string      `yaml:"error_level"`
-	Agent       AgentConfig `yaml:"agent"`
+	Format      string         `yaml:"format"`
+	AccessLog   string         `yaml:"access_log"`
+	AccessLevel string         `yaml:"access_level"`
+	ErrorLog    string         `yaml:"error_log"`
+	ErrorLevel  string         `yaml:"error_level"`
+	VModule     string         `yaml:"vmodule,omitempty"`
+	StackLevel  string         `yaml:"stack_level,omitempty"`
+	StackDepth  int            `yaml:"stack_depth,omitempty"`
+	MaxSize     int            `yaml:"max_size,omitempty"`
+	Rotate      string         `yaml:"rotate,omitempty"`
+	MaxBackups  int            `yaml:"max_backups,omitempty"`
+	MaxAge      int            `yaml:"max_age,omitempty"`
+	Outputs     []OutputConfig `yaml:"outputs,omitempty"`
+	Redact      RedactConfig   `yaml:"redact,omitempty"`
+	Metrics     MetricsConfig  `yaml:"metrics,omitempty"`
+	Agent       AgentConfig    `yaml:"agent"`
 }
 
 // AgentConfig is sub section of LogConfig.
+// SpoolDir is the directory spooling the entries when the agent is slow or
+// unreachable, SpoolSize is the maximum size of the spool in megabytes.
 type AgentConfig struct {
 	Enabled     bool   `yaml:"enabled"`
 	DSN         string `yaml:"dsn"`
@@ -30,6 +50,8 @@ type AgentConfig struct {
 	InstanceID  string `yaml:"instance_id"`
 	Category    string `yaml:"category"`
 	ChannelSize int    `yaml:"channel_size,omitempty"`
+	SpoolDir    string `yaml:"spool_dir,omitempty"`
+	SpoolSize   int    `yaml:"spool_size,omitempty"`
 }
 
 // EmptyFormatter output nothing
@@ -39,12 +61,16 @@ type EmptyFormatter struct {
 var (
 	// IsTerm instructs current stdout whether is terminal
 	IsTerm bool
-	// LogAccess is log access log
+	// LogAccess is log access log, its output, formatter and hooks are reset
+	// by InitLog and SetLogOut
 	LogAccess *logrus.Logger
-	// LogError is log error log
+	// LogError is log error log, see LogAccess
 	LogError *logrus.Logger
 	// conf package config
 	conf *Config
+	// pinned stores the outputs and agent hooks of the loggers set by
+	// SetLogOut apart from the stream loggers, they are not closed by InitLog
+	pinned sync.Map // *logrus.Logger -> map[interface{}]struct{}
 )
 
 // DefaultConfig is default configuration
@@ -68,19 +94,21 @@ func GetLogConfig() *Config {
 	return conf
 }
 
-// InitLog use for initial log module
+// InitLog use for initial log module, calling it again reconfigures the
+// loggers in place, see Reconfigure
 func InitLog(logConf *Config) error {
-	var err error
-
-	if logConf != nil {
-		conf = logConf
-	} else {
-		conf = DefaultConfig
+	if logConf == nil {
+		logConf = DefaultConfig
 	}
+	return Reconfigure(logConf)
+}
+
+// setDefaults fills in the agent host, instance id and channel size
+func (c *Config) setDefaults() {
 	// get default host and instance id from environment variables or hostname
-	if conf.Agent.Host == "" || conf.Agent.InstanceID == "" {
+	if c.Agent.Host == "" || c.Agent.InstanceID == "" {
 		hostname, _ := os.Hostname()
-		if conf.Agent.Host == "" {
+		if c.Agent.Host == "" {
 			host := os.Getenv("NODE_NAME")
 			if host == "" {
 				host = os.Getenv("HOST")
@@ -88,95 +116,178 @@ func InitLog(logConf *Config) error {
 					host = hostname
 				}
 			}
-			conf.Agent.Host = host
+			c.Agent.Host = host
 		}
-		if conf.Agent.InstanceID == "" {
+		if c.Agent.InstanceID == "" {
 			instanceID := os.Getenv("INSTANCE_ID")
 			if instanceID == "" {
 				instanceID = hostname
 			}
-			conf.Agent.InstanceID = instanceID
+			c.Agent.InstanceID = instanceID
 		}
 	}
 	// default channel size to 1024 if invalid or not set
-	if conf.Agent.ChannelSize <= 0 {
-		conf.Agent.ChannelSize = 1024
+	if c.Agent.ChannelSize <= 0 {
+		c.Agent.ChannelSize = 1024
 	}
+}
 
-	// init logger
-	LogAccess = logrus.New()
-	LogError = logrus.New()
+// streams are the stream loggers built by the config, they are not used for
+// logging but to build the states of the stream loggers
+type streams struct {
+	access      *logrus.Logger
+	errorLog    *logrus.Logger
+	accessLevel logrus.Level
+	errorLevel  logrus.Level
+	modules     *moduleRules
+	stackLevel  logrus.Level
+	stackDepth  int
+	stack       bool
+	redactor    *Redactor
+}
 
-	LogAccess.Formatter = &logrus.TextFormatter{
-		TimestampFormat: "2006/01/02 - 15:04:05",
-		FullTimestamp:   true,
+// accessState returns the state of the access stream
+func (s *streams) accessState() *streamState {
+	return s.state(s.access, s.accessLevel)
+}
+
+// errorState returns the state of the error stream
+func (s *streams) errorState() *streamState {
+	return s.state(s.errorLog, s.errorLevel)
+}
+
+func (s *streams) state(log *logrus.Logger, level logrus.Level) *streamState {
+	return &streamState{
+		formatter:  log.Formatter,
+		out:        log.Out,
+		hooks:      log.Hooks,
+		level:      level,
+		modules:    s.modules,
+		stackLevel: s.stackLevel,
+		stackDepth: s.stackDepth,
+		stack:      s.stack,
+		redactor:   s.redactor,
 	}
+}
 
-	LogError.Formatter = &logrus.TextFormatter{
-		TimestampFormat: "2006/01/02 - 15:04:05",
-		FullTimestamp:   true,
+// newStreams builds the new stream loggers by the config, the agent hook is
+// returned by agentHook
+func newStreams(c *Config, agentHook func() (*AgentHook, error)) (*streams, error) {
+	var err error
+	s := &streams{
+		access:   logrus.New(),
+		errorLog: logrus.New(),
+	}
+
+	if s.access.Formatter, err = NewFormatter(c.Format); err != nil {
+		return s, errors.New("Set log format error: " + err.Error())
+	}
+
+	if s.errorLog.Formatter, err = NewFormatter(c.Format); err != nil {
+		return s, errors.New("Set log format error: " + err.Error())
+	}
+
+	if s.redactor, err = newRedactor(c); err != nil {
+		return s, errors.New("Set redact error: " + err.Error())
 	}
 
 	// set logger
-	if err = SetLogLevel(LogAccess, conf.AccessLevel); err != nil {
-		return errors.New("Set access log level error: " + err.Error())
+	if s.accessLevel, err = logrus.ParseLevel(c.AccessLevel); err != nil {
+		return s, errors.New("Set access log level error: " + err.Error())
 	}
 
-	if err = SetLogLevel(LogError, conf.ErrorLevel); err != nil {
-		return errors.New("Set error log level error: " + err.Error())
+	if s.errorLevel, err = logrus.ParseLevel(c.ErrorLevel); err != nil {
+		return s, errors.New("Set error log level error: " + err.Error())
 	}
 
-	if err = SetLogOut(LogAccess, conf.AccessLog); err != nil {
-		return errors.New("Set access log path error: " + err.Error())
+	if s.modules, err = parseVModule(c.VModule); err != nil {
+		return s, errors.New("Set vmodule error: " + err.Error())
 	}
 
-	if err = SetLogOut(LogError, conf.ErrorLog); err != nil {
-		return errors.New("Set error log path error: " + err.Error())
+	if s.stackLevel, s.stack, err = parseStackLevel(c.StackLevel); err != nil {
+		return s, errors.New("Set stack level error: " + err.Error())
+	}
+	if s.stackDepth = c.StackDepth; s.stackDepth < 0 {
+		return s, errors.New("Set stack depth error: must not be negative")
+	} else if s.stackDepth == 0 {
+		s.stackDepth = DefaultStackDepth
 	}
 
-	return nil
+	if err = setLogOut(c, s.access, c.AccessLog, agentHook); err != nil {
+		return s, errors.New("Set access log path error: " + err.Error())
+	}
+
+	if err = setLogOut(c, s.errorLog, c.ErrorLog, agentHook); err != nil {
+		return s, errors.New("Set error log path error: " + err.Error())
+	}
+
+	if err = addSinks(c, s.access, s.errorLog); err != nil {
+		return s, errors.New("Set log outputs error: " + err.Error())
+	}
+
+	if c.Metrics.Enabled {
+		addMetricsHooks(s.access, s.errorLog, c)
+	}
+
+	return s, nil
 }
 
-// SetLogOut provide log stdout and stderr output
+// SetLogOut provide log stdout and stderr output, the output can also be the
+// file path, the syslog dsn or the journal, see NewSyslogOutput and
+// NewJournalOutput
 func SetLogOut(log *logrus.Logger, outString string) error {
+	if getStream(log) == nil {
+		if err := setLogOut(conf, log, outString, getAgentHook); err != nil {
+			return err
+		}
+		pinned.Store(log, stateResources(&streamState{out: log.Out, hooks: log.Hooks}))
+		return nil
+	}
+	// the output of a stream logger is set to its state
+	st := *loadState(log)
+	tmp := &logrus.Logger{
+		Out:       st.out,
+		Formatter: st.formatter,
+		Hooks:     make(logrus.LevelHooks, len(st.hooks)),
+	}
+	for level, hooks := range st.hooks {
+		tmp.Hooks[level] = append([]logrus.Hook(nil), hooks...)
+	}
+	if err := setLogOut(conf, tmp, outString, getAgentHook); err != nil {
+		return err
+	}
+	st.out, st.formatter, st.hooks = tmp.Out, tmp.Formatter, tmp.Hooks
+	swapState(log, &st)
+	return nil
+}
+
+// setLogOut sets the output of the logger and adds the agent hook returned
+// by agentHook if the agent is enabled
+func setLogOut(c *Config, log *logrus.Logger, outString string, agentHook func() (*AgentHook, error)) error {
 	switch outString {
-	case "stdout":
-		log.Out = os.Stdout
-	case "stderr":
-		log.Out = os.Stderr
 	case "":
 		log.Out = io.Discard
 		log.Formatter = NewEmptyFormatter()
 	default:
-		f, err := os.OpenFile(outString, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		out, formatter, err := openOutput(c, outString)
 
 		if err != nil {
 			return err
 		}
 
-		log.Out = f
+		log.Out = out
+		if formatter != nil {
+			log.Formatter = formatter
+		}
 	}
 
-	if conf != nil && conf.Agent.Enabled {
+	if c != nil && c.Agent.Enabled {
 		// configure log agent (logstash) hook
-		_, err := url.Parse(conf.Agent.DSN)
+		hook, err := agentHook()
 		if err != nil {
 			return err
 		}
-		var opt logrusagent.Options
-		opt.ChannelSize = conf.Agent.ChannelSize
-
-		fields := logrus.Fields{
-			"app_id":      conf.Agent.AppID,
-			"host":        conf.Agent.Host,
-			"instance_id": conf.Agent.InstanceID,
-		}
-		if conf.Agent.Category != "" {
-			fields["category"] = conf.Agent.Category
-		}
-		hook, _ := logrusagent.New(
-			conf.Agent.DSN, logrusagent.DefaultFormatter(fields), opt)
-		log.Hooks.Add(hook)
+		addHook(log, hook)
 	}
 
 	return nil
@@ -191,7 +302,7 @@ func SetLogLevel(log *logrus.Logger, levelString string) error {
 		return err
 	}
 
-	log.Level = level
+	setLevel(log, level)
 
 	return nil
 }
@@ -1,13 +1,29 @@
 package log_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/tengattack/tgo/log"
 )
 
+// newTestConfig returns a valid config, log.DefaultConfig is modified by tests
+func newTestConfig() *log.Config {
+	return &log.Config{
+		Format:      "string",
+		AccessLog:   "stdout",
+		AccessLevel: "info",
+		ErrorLog:    "stderr",
+		ErrorLevel:  "error",
+	}
+}
+
 func TestSetLogLevel(t *testing.T) {
 	assert := assert.New(t)
 	l := logrus.New()
@@ -84,3 +100,131 @@ func TestErrorLogPath(t *testing.T) {
 
 	assert.NotNil(log.InitLog(conf))
 }
+
+func TestFileWriterRotate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+
+	w, err := log.NewFileWriter(filename, log.RotateOptions{
+		MaxSize:    10,
+		MaxBackups: 2,
+	})
+	assert.NoError(err)
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err = w.Write([]byte("12345678\n"))
+		assert.NoError(err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "access-*.log"))
+	assert.NoError(err)
+	assert.Len(matches, 2)
+	b, err := os.ReadFile(filename)
+	assert.NoError(err)
+	assert.Equal("12345678\n", string(b))
+
+	_, err = log.NewFileWriter(filename, log.RotateOptions{Every: "weekly"})
+	assert.Error(err)
+}
+
+func TestFileWriterConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+
+	w, err := log.NewFileWriter(filename, log.RotateOptions{MaxSize: 1024})
+	assert.NoError(err)
+	defer w.Close()
+
+	l := logrus.New()
+	l.Out = w
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("concurrent rotation")
+			}
+		}()
+	}
+	wg.Wait()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "access*.log"))
+	assert.NoError(err)
+	var lines int
+	for _, m := range matches {
+		b, err := os.ReadFile(m)
+		assert.NoError(err)
+		lines += strings.Count(string(b), "\n")
+	}
+	assert.Equal(800, lines)
+}
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+	l := logrus.New()
+
+	assert.NoError(log.SetLogOut(l, filename))
+	l.Info("before rotation")
+	assert.NoError(os.Rename(filename, filename+".1"))
+	l.Info("after rename")
+	assert.NoError(log.Reopen())
+	l.Info("after reopen")
+
+	b, err := os.ReadFile(filename + ".1")
+	assert.NoError(err)
+	assert.Contains(string(b), "before rotation")
+	assert.Contains(string(b), "after rename")
+	assert.NotContains(string(b), "after reopen")
+	b, err = os.ReadFile(filename)
+	assert.NoError(err)
+	assert.Equal(1, strings.Count(string(b), "\n"))
+	assert.Contains(string(b), "after reopen")
+
+	// stop can be called more than once
+	stop := log.ReopenOnSignal()
+	stop()
+	stop()
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	conf := *log.DefaultConfig
+	conf.AccessLevel = "info"
+	conf.ErrorLevel = "error"
+	conf.AccessLog = filepath.Join(t.TempDir(), "access.log")
+	conf.ErrorLog = "stderr"
+
+	conf.Format = "json"
+	assert.NoError(log.InitLog(&conf))
+	log.LogAccess.Info("foo")
+	b, err := os.ReadFile(conf.AccessLog)
+	assert.NoError(err)
+	assert.Contains(string(b), `"msg":"foo"`)
+
+	conf.Format = "xml"
+	assert.EqualError(log.InitLog(&conf), "Set log format error: unknown log format: \"xml\"")
+
+	_, err = log.NewFormatter("")
+	assert.NoError(err)
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	assert := assert.New(t)
+	f, err := log.NewFormatter(log.FormatLogfmt)
+	assert.NoError(err)
+
+	entry := logrus.NewEntry(logrus.New())
+	entry.Time = time.Date(2019, 1, 31, 4, 48, 20, 0, time.UTC)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "say \"hi\"\n"
+	entry.Data = logrus.Fields{"a b": "x=y", "empty": "", "n": 1}
+	b, err := f.Format(entry)
+	assert.NoError(err)
+	assert.Equal(`time=2019-01-31T04:48:20Z level=info msg="say \"hi\"\n" a_b="x=y" empty= n=1`+"\n", string(b))
+}
@@ -0,0 +1,182 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsConfig is sub section of LogConfig.
+// ByCaller and ByCategory add the caller file and the category field as the
+// labels of the entry counters.
+type MetricsConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	ByCaller   bool `yaml:"by_caller,omitempty"`
+	ByCategory bool `yaml:"by_category,omitempty"`
+}
+
+// MetricsHook is a logrus hook which counts the entries by level, and by
+// caller file and category optionally
+type MetricsHook struct {
+	stream   string
+	category string
+	conf     MetricsConfig
+}
+
+// entryLabels are the labels of the entry counter
+type entryLabels struct {
+	stream   string
+	level    string
+	file     string
+	category string
+}
+
+var (
+	// entryCounts are the entry counters by labels
+	entryCounts sync.Map
+	// outputBytes are the bytes written counters by output
+	outputBytes sync.Map
+)
+
+// NewMetricsHook creates the metrics hook for the stream, the category is
+// used if the entry has no category field
+func NewMetricsHook(stream, category string, conf MetricsConfig) *MetricsHook {
+	return &MetricsHook{
+		stream:   stream,
+		category: category,
+		conf:     conf,
+	}
+}
+
+// Levels returns all the levels
+func (h *MetricsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire counts the entry
+func (h *MetricsHook) Fire(entry *logrus.Entry) error {
+	labels := entryLabels{
+		stream: h.stream,
+		level:  entry.Level.String(),
+	}
+	if h.conf.ByCaller {
+		if file, _, ok := EntryCaller(entry); ok {
+			labels.file = file
+		}
+	}
+	if h.conf.ByCategory {
+		if category, ok := entry.Data["category"].(string); ok {
+			labels.category = category
+		} else {
+			labels.category = h.category
+		}
+	}
+	addCounter(&entryCounts, labels, 1)
+	return nil
+}
+
+// meteredWriter counts the bytes written to the output
+type meteredWriter struct {
+	io.Writer
+	output string
+}
+
+// Write writes to the output and counts the bytes written
+func (w *meteredWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	addCounter(&outputBytes, w.output, uint64(n))
+	return n, err
+}
+
+// Unwrap returns the output writer
+func (w *meteredWriter) Unwrap() io.Writer {
+	return w.Writer
+}
+
+func addCounter(m *sync.Map, key interface{}, n uint64) {
+	v, ok := m.Load(key)
+	if !ok {
+		v, _ = m.LoadOrStore(key, new(uint64))
+	}
+	atomic.AddUint64(v.(*uint64), n)
+}
+
+// addMetricsHooks adds the metrics hooks to the stream loggers
+func addMetricsHooks(access, errorLog *logrus.Logger, conf *Config) {
+	access.AddHook(NewMetricsHook(StreamAccess, conf.Agent.Category, conf.Metrics))
+	errorLog.AddHook(NewMetricsHook(StreamError, conf.Agent.Category, conf.Metrics))
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format
+func WriteMetrics(w io.Writer) error {
+	var entries, outputs []string
+	entryCounts.Range(func(key, value interface{}) bool {
+		l := key.(entryLabels)
+		labels := []string{"stream", l.stream, "level", l.level}
+		if l.file != "" {
+			labels = append(labels, "file", l.file)
+		}
+		if l.category != "" {
+			labels = append(labels, "category", l.category)
+		}
+		entries = append(entries, metricLine("log_entries_total", atomic.LoadUint64(value.(*uint64)), labels...))
+		return true
+	})
+	outputBytes.Range(func(key, value interface{}) bool {
+		outputs = append(outputs, metricLine("log_output_bytes_total",
+			atomic.LoadUint64(value.(*uint64)), "output", key.(string)))
+		return true
+	})
+	sort.Strings(entries)
+	sort.Strings(outputs)
+
+	b := bufio.NewWriter(w)
+	b.WriteString("# HELP log_entries_total Number of log entries.\n")
+	b.WriteString("# TYPE log_entries_total counter\n")
+	for _, line := range entries {
+		b.WriteString(line)
+	}
+	b.WriteString("# HELP log_output_bytes_total Number of bytes written to log outputs.\n")
+	b.WriteString("# TYPE log_output_bytes_total counter\n")
+	for _, line := range outputs {
+		b.WriteString(line)
+	}
+	return b.Flush()
+}
+
+// MetricsHandler returns the handler serving the metrics in the Prometheus
+// text exposition format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteMetrics(w)
+	})
+}
+
+// metricLine returns the sample line with the label name and value pairs
+// eg: log_entries_total{stream="error",level="error"} 1
+func metricLine(name string, value uint64, labels ...string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	fmt.Fprintf(&b, "} %d\n", value)
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,62 @@
+package log_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	filename := filepath.Join(t.TempDir(), "metrics.log")
+
+	conf := newTestConfig()
+	conf.Format = "json"
+	conf.AccessLog = filename
+	conf.ErrorLog = ""
+	conf.ErrorLevel = "warn"
+	conf.Agent.Category = "tgo"
+	conf.Metrics = log.MetricsConfig{Enabled: true, ByCategory: true}
+	assert.NoError(log.InitLog(conf))
+
+	log.LogAccess.Info("foo")
+	log.LogAccess.WithField("category", `a"b`).Info("bar")
+	log.LogError.Error("foo")
+	log.LogError.Warn("bar")
+	log.LogError.Info("disabled")
+	assert.NoError(log.Close(context.Background()))
+
+	w := httptest.NewRecorder()
+	log.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(200, w.Code)
+	assert.Contains(w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	body := w.Body.String()
+	assert.Contains(body, "# TYPE log_entries_total counter\n")
+	assert.Contains(body, `log_entries_total{stream="access",level="info",category="a\"b"} 1`+"\n")
+	assert.Contains(body, `log_entries_total{stream="access",level="info",category="tgo"} 1`+"\n")
+	assert.Contains(body, `log_entries_total{stream="error",level="error",category="tgo"} 1`+"\n")
+	assert.Contains(body, `log_entries_total{stream="error",level="warning",category="tgo"} 1`+"\n")
+	assert.NotContains(body, `level="info",category="tgo"} 2`)
+	assert.Regexp(`log_output_bytes_total\{output="`+regexp.QuoteMeta(filename)+`"\} [1-9]\d*\n`, body)
+}
+
+func TestMetricsHookByCaller(t *testing.T) {
+	assert := assert.New(t)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.SetReportCaller(true)
+	l.AddHook(log.NewMetricsHook("caller", "", log.MetricsConfig{Enabled: true, ByCaller: true}))
+	l.Error("foo")
+	l.Error("bar")
+
+	w := httptest.NewRecorder()
+	log.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Regexp(`log_entries_total\{stream="caller",level="error",file="\S+metrics_test\.go"\} 2\n`, w.Body.String())
+}
@@ -0,0 +1,318 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ReconfigureTimeout is the maximum duration waiting for the previous
+	// agent hooks to send the queued entries when reconfiguring
+	ReconfigureTimeout = 5 * time.Second
+
+	reconfigureMu sync.Mutex
+)
+
+// Reconfigure builds the outputs, formatters and hooks of the config, then
+// swaps the states of LogAccess and LogError in place, so the loggers held by
+// other packages keep working. Each state is swapped as a whole, so an entry
+// is filtered, formatted and hooked by either the previous or the new config,
+// the entries logged while swapping may be written to the new output. The
+// previous outputs and hooks not used by any logger anymore are drained and
+// closed after swapping.
+// The loggers are left unchanged if the config can't be applied.
+func Reconfigure(newConf *Config) error {
+	reconfigureMu.Lock()
+	defer reconfigureMu.Unlock()
+
+	newConf.setDefaults()
+
+	oldConf := conf
+	agentMu.Lock()
+	oldAgentHook := agentHook
+	agentMu.Unlock()
+
+	conf = newConf
+	resetAgentHook()
+	s, err := newStreams(newConf, getAgentHook)
+	if err != nil {
+		conf = oldConf
+		agentMu.Lock()
+		agentHook = oldAgentHook
+		agentMu.Unlock()
+		// close the outputs opened for the config
+		_ = closeResources(context.Background(), releasedResources(s.accessState(), s.errorState()))
+		return err
+	}
+
+	if LogAccess == nil || LogError == nil {
+		LogAccess = logrus.New()
+		LogError = logrus.New()
+	}
+	resetLevels()
+	redactor.Store(s.redactor)
+	old := []*streamState{
+		swapStream(LogAccess, s.accessState()),
+		swapStream(LogError, s.errorState()),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ReconfigureTimeout)
+	defer cancel()
+	if err = closeResources(ctx, releasedResources(old...)); err != nil {
+		return errors.New("Close previous log outputs error: " + err.Error())
+	}
+	return nil
+}
+
+// swapStream swaps the state of the stream logger and returns the previous
+// one, the logger not being a stream logger yet becomes one
+func swapStream(log *logrus.Logger, st *streamState) *streamState {
+	if prev := loadState(log); prev != nil {
+		swapState(log, st)
+		return prev
+	}
+	// the hooks and output set to the logger directly are released too
+	prev := &streamState{out: log.Out, hooks: log.Hooks}
+	attachStream(log, st)
+	return prev
+}
+
+// NewLoggers builds the access and error loggers of the config apart from
+// LogAccess and LogError, with their own outputs, formatters, agent hook,
+// redactor and vmodule rules. The loggers should be closed by CloseLoggers.
+func NewLoggers(c *Config) (access, errorLog *logrus.Logger, err error) {
+	reconfigureMu.Lock()
+	defer reconfigureMu.Unlock()
+
+	if c == nil {
+		c = DefaultConfig
+	}
+	newConf := *c
+	newConf.setDefaults()
+	var hook *AgentHook
+	s, err := newStreams(&newConf, func() (*AgentHook, error) {
+		if hook != nil {
+			return hook, nil
+		}
+		h, err := newAgentHook(&newConf.Agent)
+		if err != nil {
+			return nil, err
+		}
+		agentMu.Lock()
+		agentHooks = append(agentHooks, h)
+		agentMu.Unlock()
+		hook = h
+		return h, nil
+	})
+	if err != nil {
+		_ = closeResources(context.Background(), releasedResources(s.accessState(), s.errorState()))
+		return nil, nil, err
+	}
+	access, errorLog = logrus.New(), logrus.New()
+	attachStream(access, s.accessState())
+	attachStream(errorLog, s.errorState())
+	return access, errorLog, nil
+}
+
+// CloseLoggers waits for the agent hooks of the loggers built by NewLoggers
+// to send the queued entries until ctx is done, then closes their outputs
+// not used by any other logger
+func CloseLoggers(ctx context.Context, loggers ...*logrus.Logger) error {
+	reconfigureMu.Lock()
+	defer reconfigureMu.Unlock()
+	var states []*streamState
+	for _, log := range loggers {
+		if log == nil || log == LogAccess || log == LogError {
+			continue
+		}
+		if st := loadState(log); st != nil {
+			states = append(states, st)
+			detachStream(log)
+		}
+	}
+	return closeResources(ctx, releasedResources(states...))
+}
+
+// releasedResources returns the resources used by the states but not by the
+// live stream loggers or the loggers set by SetLogOut
+func releasedResources(states ...*streamState) map[interface{}]struct{} {
+	res := stateResources(states...)
+	for r := range stateResources(liveStates()...) {
+		delete(res, r)
+	}
+	pinned.Range(func(key, value interface{}) bool {
+		for r := range value.(map[interface{}]struct{}) {
+			delete(res, r)
+		}
+		return true
+	})
+	return res
+}
+
+// stateResources returns the outputs, agent hooks and spools used by the
+// states
+func stateResources(states ...*streamState) map[interface{}]struct{} {
+	res := map[interface{}]struct{}{}
+	addWriter := func(w io.Writer) {
+		for {
+			u, ok := w.(interface{ Unwrap() io.Writer })
+			if !ok {
+				break
+			}
+			w = u.Unwrap()
+		}
+		if w != nil {
+			res[w] = struct{}{}
+		}
+	}
+	for _, st := range states {
+		if st == nil {
+			continue
+		}
+		addWriter(st.out)
+		for _, hooks := range st.hooks {
+			for _, hook := range hooks {
+				switch h := hook.(type) {
+				case *Sink:
+					addWriter(h.out)
+				case *AgentHook:
+					res[h] = struct{}{}
+					if h.spool != nil {
+						res[h.spool] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// closeResources closes the agent hooks, spools, outputs and files in res
+// which are opened by InitLog or Reconfigure
+func closeResources(ctx context.Context, res map[interface{}]struct{}) error {
+	var errs []error
+
+	agentMu.Lock()
+	var hooks, kept []*AgentHook
+	for _, hook := range agentHooks {
+		if _, ok := res[hook]; ok {
+			hooks = append(hooks, hook)
+		} else {
+			kept = append(kept, hook)
+		}
+	}
+	agentHooks = kept
+	agentMu.Unlock()
+	for _, hook := range hooks {
+		if err := hook.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	spoolsMu.Lock()
+	for dir, s := range spools {
+		if _, ok := res[s]; ok {
+			if err := s.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			delete(spools, dir)
+		}
+	}
+	spoolsMu.Unlock()
+
+	closersMu.Lock()
+	var keptClosers []io.Closer
+	for _, c := range closers {
+		if _, ok := res[c]; !ok {
+			keptClosers = append(keptClosers, c)
+			continue
+		}
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	closers = keptClosers
+	closersMu.Unlock()
+
+	filesMu.Lock()
+	for filename, w := range files {
+		if _, ok := res[w]; ok {
+			if err := w.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			delete(files, filename)
+		}
+	}
+	filesMu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// WatchConfig polls the yaml config file every interval, and reconfigures
+// the loggers by LoadConfig when the file content changes, the flags
+// registered by RegisterFlags on the current config are applied again. The
+// invalid config is reported to stderr and ignored.
+func WatchConfig(path string, interval time.Duration) (stop func()) {
+	return WatchConfigFunc(path, interval, func() (*Config, error) {
+		c, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		reconfigureMu.Lock()
+		current := conf
+		reconfigureMu.Unlock()
+		if err = applyOverrides(current, c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+// WatchConfigFunc is WatchConfig loading the config by load, eg: to apply the
+// changes made to the config in code after loading
+func WatchConfigFunc(path string, interval time.Duration, load func() (*Config, error)) (stop func()) {
+	last, _ := os.ReadFile(path)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			b, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(b, last) {
+				continue
+			}
+			last = b
+			if err = reloadConfig(load); err != nil {
+				fmt.Fprintln(os.Stderr, "log config reload error:", err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func reloadConfig(load func() (*Config, error)) error {
+	c, err := load()
+	if err != nil {
+		return err
+	}
+	if err = c.Validate(); err != nil {
+		return err
+	}
+	return Reconfigure(c)
+}
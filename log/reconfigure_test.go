@@ -0,0 +1,166 @@
+package log_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func TestReconfigure(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	conf := newTestConfig()
+	conf.AccessLog = first
+	assert.NoError(log.InitLog(conf))
+	access := log.LogAccess
+
+	// log concurrently while reconfiguring
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					access.Info("concurrent")
+				}
+			}
+		}()
+	}
+	conf = newTestConfig()
+	conf.Format = "json"
+	conf.AccessLog = second
+	conf.AccessLevel = "warn"
+	assert.NoError(log.Reconfigure(conf))
+	close(done)
+	wg.Wait()
+
+	// each entry is handled by a single config, the entries handled by the
+	// first one may be written to the second output while swapping
+	b, err := os.ReadFile(first)
+	assert.NoError(err)
+	assert.NotContains(string(b), `"msg"`)
+	b, err = os.ReadFile(second)
+	assert.NoError(err)
+	assert.NotContains(string(b), `"msg":"concurrent"`)
+
+	// the loggers are swapped in place
+	assert.Same(access, log.LogAccess)
+	assert.False(log.LogAccess.IsLevelEnabled(logrus.InfoLevel))
+	firstSize := fileSize(t, first)
+	log.LogAccess.Warn("after reconfigure")
+	assert.Equal(firstSize, fileSize(t, first))
+	b, err = os.ReadFile(second)
+	assert.NoError(err)
+	assert.Contains(string(b), `"msg":"after reconfigure"`)
+
+	// the invalid config is not applied
+	conf = newTestConfig()
+	conf.AccessLog = first
+	conf.Format = "xml"
+	assert.Error(log.Reconfigure(conf))
+	log.LogAccess.Warn("still second")
+	assert.Equal(firstSize, fileSize(t, first))
+	b, err = os.ReadFile(second)
+	assert.NoError(err)
+	assert.Contains(string(b), `"msg":"still second"`)
+}
+
+func TestReconfigureSetters(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	conf := newTestConfig()
+	conf.AccessLog = first
+	assert.NoError(log.InitLog(conf))
+
+	// the logrus setters are used until reconfiguring
+	var buf strings.Builder
+	log.LogAccess.SetOutput(&buf)
+	log.LogAccess.SetFormatter(&logrus.JSONFormatter{})
+	log.LogAccess.SetLevel(logrus.DebugLevel)
+	log.LogAccess.Debug("setters")
+	assert.Equal(1, strings.Count(buf.String(), "\n"))
+	assert.Contains(buf.String(), `"msg":"setters"`)
+	assert.Equal(int64(0), fileSize(t, first))
+	assert.Equal(log.Levels{AccessLevel: "debug", ErrorLevel: "error"}, log.GetLevels())
+
+	// the hooks replaced are added back by reconfiguring
+	log.LogAccess.ReplaceHooks(logrus.LevelHooks{})
+	conf = newTestConfig()
+	conf.AccessLog = second
+	assert.NoError(log.InitLog(conf))
+	log.LogAccess.Debug("debug")
+	log.LogAccess.Info("reconfigured")
+	b, err := os.ReadFile(second)
+	assert.NoError(err)
+	assert.NotContains(string(b), "debug")
+	assert.Contains(string(b), "reconfigured")
+	assert.Equal(1, strings.Count(buf.String(), "\n"))
+
+	// the plain logger keeps its output opened by the previous config
+	l := logrus.New()
+	assert.NoError(log.SetLogOut(l, second))
+	assert.NoError(log.InitLog(newTestConfig()))
+	l.Info("plain")
+	b, err = os.ReadFile(second)
+	assert.NoError(err)
+	assert.Contains(string(b), "plain")
+}
+
+func TestWatchConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.yml")
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+	// DefaultConfig may be changed by other tests
+	writeConfig := func(accessLog string) {
+		assert.NoError(os.WriteFile(path, []byte("format: string\naccess_log: "+accessLog+
+			"\naccess_level: info\nerror_log: \"\"\nerror_level: error\n"), 0644))
+	}
+
+	writeConfig(first)
+	conf, err := log.LoadConfig(path)
+	assert.NoError(err)
+	// the flags still override the reloaded config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	log.RegisterFlags(fs, conf)
+	assert.NoError(fs.Parse([]string{"-log.format=json"}))
+	assert.NoError(log.InitLog(conf))
+	stop := log.WatchConfig(path, 10*time.Millisecond)
+	defer stop()
+
+	writeConfig(second)
+	assert.Eventually(func() bool {
+		log.LogAccess.Info("watch")
+		b, _ := os.ReadFile(second)
+		return strings.Contains(string(b), `"msg":"watch"`)
+	}, 5*time.Second, 20*time.Millisecond)
+	stop()
+}
+
+func fileSize(t *testing.T, filename string) int64 {
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Reopen reopens all the log files opened by SetLogOut, it is used after the
+// log files are renamed by an external tool like logrotate
+func Reopen() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	var errs []error
+	for _, w := range files {
+		if err := w.Reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReopenOnSignal reopens the log files when receiving the signals, SIGHUP is
+// used if no signal is given, call the returned function to stop it
+func ReopenOnSignal(sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sig...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := Reopen(); err != nil && LogError != nil {
+					LogError.Errorf("reopen log files error: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotation periods
+const (
+	RotateNone   = ""
+	RotateDaily  = "daily"
+	RotateHourly = "hourly"
+)
+
+// backupTimeFormat is the timestamp layout in rotated file names
+// eg: access-2019-01-31T04-48-20.259.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions controls when and how a FileWriter rotates its file
+type RotateOptions struct {
+	// MaxSize is the maximum size in bytes before the file gets rotated,
+	// zero disables size based rotation
+	MaxSize int64
+	// Every is the time based rotation period: daily, hourly or empty
+	Every string
+	// MaxBackups is the maximum number of rotated files to retain
+	MaxBackups int
+	// MaxAge is the maximum duration to retain rotated files
+	MaxAge time.Duration
+}
+
+// FileWriter is a log file writer which supports size and time based
+// rotation, it is safe for concurrent use
+type FileWriter struct {
+	mu       sync.Mutex
+	filename string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	period   time.Time
+	closed   bool
+}
+
+var (
+	// currentTime is used to get the current time, for testing purpose
+	currentTime = time.Now
+
+	filesMu sync.Mutex
+	// files are the opened file writers by path
+	files = map[string]*FileWriter{}
+)
+
+// NewFileWriter opens the file for appending logs
+func NewFileWriter(filename string, opts RotateOptions) (*FileWriter, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	w := &FileWriter{
+		filename: filename,
+		opts:     opts,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// rotateOptions returns the rotate options of the config
+func (c *Config) rotateOptions() RotateOptions {
+	return RotateOptions{
+		MaxSize:    int64(c.MaxSize) * 1024 * 1024,
+		Every:      c.Rotate,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     time.Duration(c.MaxAge) * 24 * time.Hour,
+	}
+}
+
+func (opts RotateOptions) validate() error {
+	switch opts.Every {
+	case RotateNone, RotateDaily, RotateHourly:
+	default:
+		return fmt.Errorf("unknown rotate period: %q", opts.Every)
+	}
+	if opts.MaxSize < 0 || opts.MaxBackups < 0 || opts.MaxAge < 0 {
+		return errors.New("rotate options must not be negative")
+	}
+	return nil
+}
+
+// openFileWriter returns the file writer for the path, writers are shared
+// between loggers so that a rotation won't leave another logger writing to
+// the renamed file
+func openFileWriter(filename string, opts RotateOptions) (*FileWriter, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	if w, ok := files[filename]; ok {
+		w.mu.Lock()
+		w.opts = opts
+		w.mu.Unlock()
+		return w, nil
+	}
+	w, err := NewFileWriter(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	files[filename] = w
+	return w, nil
+}
+
+// Filename returns the path of the current log file
+func (w *FileWriter) Filename() string {
+	return w.filename
+}
+
+// Write writes the log to the file and rotates it if needed
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it with a timestamp and opens
+// a new file
+func (w *FileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen opens the file by its path again and then closes the previous file
+// handle, writes are blocked during reopening so no log will be lost
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Sync commits the written logs to stable storage
+func (w *FileWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close syncs and closes the file, writes after closing return os.ErrClosed
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			w.close()
+			return err
+		}
+	}
+	return w.close()
+}
+
+func (w *FileWriter) open() error {
+	f, err := os.OpenFile(w.filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	if w.size > 0 {
+		// an existing file belongs to the period it was last written
+		w.period = w.periodStart(info.ModTime())
+	} else {
+		w.period = w.periodStart(currentTime())
+	}
+	return nil
+}
+
+func (w *FileWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *FileWriter) shouldRotate(n int) bool {
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.opts.MaxSize {
+		return true
+	}
+	if w.opts.Every != RotateNone && w.periodStart(currentTime()).After(w.period) {
+		return true
+	}
+	return false
+}
+
+func (w *FileWriter) rotate() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+	// avoid overwriting a backup rotated within the same millisecond
+	t := currentTime()
+	for {
+		if _, err := os.Stat(w.backupName(t)); os.IsNotExist(err) {
+			break
+		}
+		t = t.Add(time.Millisecond)
+	}
+	err := os.Rename(w.filename, w.backupName(t))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = w.open(); err != nil {
+		return err
+	}
+	w.period = w.periodStart(currentTime())
+	return w.removeBackups()
+}
+
+// periodStart returns the start time of the rotation period contains t
+func (w *FileWriter) periodStart(t time.Time) time.Time {
+	switch w.opts.Every {
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+// backupName returns the file name to rotate to
+// eg: logs/access.log => logs/access-2019-01-31T04-48-20.259.log
+func (w *FileWriter) backupName(t time.Time) string {
+	dir, prefix, ext := w.backupParts()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+func (w *FileWriter) backupParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.filename)
+	name := filepath.Base(w.filename)
+	ext = filepath.Ext(name)
+	prefix = strings.TrimSuffix(name, ext) + "-"
+	return
+}
+
+type backupFile struct {
+	path string
+	t    time.Time
+}
+
+// removeBackups deletes the rotated files exceeding MaxBackups or MaxAge
+func (w *FileWriter) removeBackups() error {
+	if w.opts.MaxBackups <= 0 && w.opts.MaxAge <= 0 {
+		return nil
+	}
+	dir, prefix, ext := w.backupParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), t: t})
+	}
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].t.After(backups[j].t)
+	})
+
+	var errs []error
+	cutoff := currentTime().Add(-w.opts.MaxAge)
+	for i, b := range backups {
+		if (w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups) ||
+			(w.opts.MaxAge > 0 && b.t.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
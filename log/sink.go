@@ -0,0 +1,261 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// log streams
+const (
+	StreamAccess = "access"
+	StreamError  = "error"
+)
+
+// OutputConfig is an additional output (sink) of the access or error stream,
+// Path is the same as AccessLog, Format defaults to Config.Format, and the
+// entry fields can be filtered by IncludeFields and ExcludeFields.
+// Level is the minimum level of the entries written, the entries are
+// filtered by the stream level first, so a level more verbose than the stream
+// level, eg: debug of an info stream, writes the same as the stream level.
+type OutputConfig struct {
+	Stream        string   `yaml:"stream"`
+	Path          string   `yaml:"path"`
+	Level         string   `yaml:"level,omitempty"`
+	Format        string   `yaml:"format,omitempty"`
+	IncludeFields []string `yaml:"include_fields,omitempty"`
+	ExcludeFields []string `yaml:"exclude_fields,omitempty"`
+}
+
+// Sink is a logrus hook which writes the entries to its own output with its
+// own formatter
+type Sink struct {
+	mu        sync.Mutex
+	out       io.Writer
+	formatter logrus.Formatter
+	levels    []logrus.Level
+	include   map[string]struct{}
+	exclude   map[string]struct{}
+}
+
+// NewSink creates the sink of the output config, defaultFormat is used if
+// the output format is not set
+func NewSink(o OutputConfig, defaultFormat string) (*Sink, error) {
+	return newSink(conf, o, defaultFormat)
+}
+
+func newSink(c *Config, o OutputConfig, defaultFormat string) (*Sink, error) {
+	if o.Path == "" {
+		return nil, errors.New("empty output path")
+	}
+	level := logrus.TraceLevel
+	if o.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(o.Level); err != nil {
+			return nil, err
+		}
+	}
+	format := o.Format
+	if format == "" {
+		format = defaultFormat
+	}
+	formatter, err := NewFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+	out, outFormatter, err := openOutput(c, o.Path)
+	if err != nil {
+		return nil, err
+	}
+	if outFormatter != nil {
+		formatter = outFormatter
+	}
+
+	s := &Sink{
+		out:       out,
+		formatter: formatter,
+		levels:    make([]logrus.Level, 0, len(logrus.AllLevels)),
+	}
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			s.levels = append(s.levels, l)
+		}
+	}
+	if len(o.IncludeFields) > 0 {
+		s.include = make(map[string]struct{}, len(o.IncludeFields))
+		for _, k := range o.IncludeFields {
+			s.include[k] = struct{}{}
+		}
+	}
+	if len(o.ExcludeFields) > 0 {
+		s.exclude = make(map[string]struct{}, len(o.ExcludeFields))
+		for _, k := range o.ExcludeFields {
+			s.exclude[k] = struct{}{}
+		}
+	}
+	return s, nil
+}
+
+// Levels returns the levels not less severe than the sink level
+func (s *Sink) Levels() []logrus.Level {
+	return s.levels
+}
+
+// sinkKey is the context key of the sink formatting the entry
+type sinkKey struct{}
+
+// Fire formats the entry with the filtered fields and writes to the output
+func (s *Sink) Fire(entry *logrus.Entry) error {
+	e := *entry
+	e.Buffer = nil
+	e.Data = s.filter(entry.Data)
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e.Context = context.WithValue(ctx, sinkKey{}, s)
+	b, err := s.formatter.Format(&e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(b)
+	return err
+}
+
+// filter returns the fields allowed by IncludeFields and ExcludeFields
+func (s *Sink) filter(fields logrus.Fields) logrus.Fields {
+	if s.include == nil && s.exclude == nil {
+		return fields
+	}
+	filtered := make(logrus.Fields, len(fields))
+	for k, v := range fields {
+		if _, ok := s.include[k]; s.include != nil && !ok {
+			continue
+		}
+		if _, ok := s.exclude[k]; ok {
+			continue
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
+
+// EntryOutput returns the output the entry is written to for the formatters
+// depending on it, eg: colors for terminals, the sinks write the entries to
+// their own outputs
+func EntryOutput(entry *logrus.Entry) io.Writer {
+	if s := entrySink(entry); s != nil {
+		return s.out
+	}
+	if entry.Logger == nil {
+		return nil
+	}
+	return entry.Logger.Out
+}
+
+// FilterFields returns the fields allowed by the output the entry is written
+// to, for the formatters adding the fields not in the entry data, eg: the
+// fields of the entry context
+func FilterFields(entry *logrus.Entry, fields logrus.Fields) logrus.Fields {
+	if s := entrySink(entry); s != nil {
+		return s.filter(fields)
+	}
+	return fields
+}
+
+// entrySink returns the sink formatting the entry if any
+func entrySink(entry *logrus.Entry) *Sink {
+	if entry.Context == nil {
+		return nil
+	}
+	s, _ := entry.Context.Value(sinkKey{}).(*Sink)
+	return s
+}
+
+// openOutput opens the output by path: stdout, stderr, the syslog dsn, the
+// journal or the file path, the formatter is returned for the outputs require their own format.
+// The bytes written are counted if the metrics is enabled.
+func openOutput(c *Config, path string) (io.Writer, logrus.Formatter, error) {
+	w, formatter, err := openWriter(c, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c != nil && c.Metrics.Enabled {
+		w = &meteredWriter{Writer: w, output: RedactDSN(path)}
+	}
+	return w, formatter, nil
+}
+
+func openWriter(c *Config, path string) (io.Writer, logrus.Formatter, error) {
+	switch path {
+	case "stdout":
+		return os.Stdout, nil, nil
+	case "stderr":
+		return os.Stderr, nil, nil
+	}
+	if isSyslogOutput(path) {
+		w, formatter, err := newSyslogOutput(c, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		trackCloser(w)
+		return w, formatter, nil
+	}
+	if isJournalOutput(path) {
+		w, formatter, err := newJournalOutput(c, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		trackCloser(w)
+		return w, formatter, nil
+	}
+	var opts RotateOptions
+	if c != nil {
+		opts = c.rotateOptions()
+	}
+	w, err := openFileWriter(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, nil, nil
+}
+
+// addSinks adds the sinks of the outputs to the stream loggers
+func addSinks(c *Config, access, errorLog *logrus.Logger) error {
+	for i, o := range c.Outputs {
+		var log *logrus.Logger
+		switch o.Stream {
+		case StreamAccess:
+			log = access
+		case StreamError:
+			log = errorLog
+		default:
+			return fmt.Errorf("outputs[%d]: unknown stream: %q", i, o.Stream)
+		}
+		sink, err := newSink(c, o, c.Format)
+		if err != nil {
+			return fmt.Errorf("outputs[%d]: %v", i, err)
+		}
+		log.AddHook(sink)
+	}
+	return nil
+}
+
+var (
+	closersMu sync.Mutex
+	// closers are the outputs other than files to be closed by Close
+	closers []io.Closer
+)
+
+func trackCloser(c io.Closer) {
+	closersMu.Lock()
+	defer closersMu.Unlock()
+	closers = append(closers, c)
+}
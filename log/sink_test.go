@@ -0,0 +1,50 @@
+package log_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func TestOutputs(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	conf := newTestConfig()
+	conf.AccessLog = ""
+	conf.Outputs = []log.OutputConfig{
+		{Stream: "access", Path: filepath.Join(dir, "access.json"), Format: "json"},
+		{Stream: "access", Path: filepath.Join(dir, "warn.log"), Level: "warn", ExcludeFields: []string{"token"}},
+		{Stream: "error", Path: filepath.Join(dir, "error.log"), IncludeFields: []string{"user"}},
+	}
+	assert.NoError(log.InitLog(conf))
+
+	log.LogAccess.WithField("user", "foo").Info("info message")
+	log.LogAccess.WithField("token", "secret").Warn("warn message")
+	log.LogError.WithField("user", "foo").WithField("token", "secret").Error("error message")
+
+	b, err := os.ReadFile(filepath.Join(dir, "access.json"))
+	assert.NoError(err)
+	assert.Equal(2, strings.Count(string(b), "\n"))
+	assert.Contains(string(b), `"msg":"info message"`)
+	assert.Contains(string(b), `"token":"secret"`)
+
+	b, err = os.ReadFile(filepath.Join(dir, "warn.log"))
+	assert.NoError(err)
+	assert.NotContains(string(b), "info message")
+	assert.Contains(string(b), "warn message")
+	assert.NotContains(string(b), "secret")
+
+	b, err = os.ReadFile(filepath.Join(dir, "error.log"))
+	assert.NoError(err)
+	assert.Contains(string(b), "user=foo")
+	assert.NotContains(string(b), "secret")
+
+	conf.Outputs = []log.OutputConfig{{Stream: "debug", Path: "stdout"}}
+	assert.EqualError(log.InitLog(conf), "Set log outputs error: outputs[0]: unknown stream: \"debug\"")
+	conf.Outputs = []log.OutputConfig{{Stream: "access", Path: "stdout", Format: "xml"}}
+	assert.Error(log.InitLog(conf))
+}
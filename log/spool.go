@@ -0,0 +1,531 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// spoolSegmentExt is the extension of the spool segment files
+	// eg: 00000000000000000001.spool
+	spoolSegmentExt = ".spool"
+	// spoolCursorFile is the file persisting the read position of the spool
+	spoolCursorFile = "cursor"
+	// spoolHeaderSize is the size of the record length header
+	spoolHeaderSize = 4
+	// DefaultSpoolSegmentSize is the default size of a spool segment file
+	DefaultSpoolSegmentSize = 16 * 1024 * 1024
+)
+
+// ErrSpoolFull is returned when appending to a spool reached its MaxSize
+var ErrSpoolFull = errors.New("log spool is full")
+
+// SpoolOptions controls the size of the spool
+type SpoolOptions struct {
+	// SegmentSize is the maximum size in bytes of a segment file,
+	// DefaultSpoolSegmentSize is used if it is zero
+	SegmentSize int64
+	// MaxSize is the maximum size in bytes of all the segment files,
+	// zero means no limit
+	MaxSize int64
+}
+
+// Spool is a disk-backed FIFO queue of records, the records are appended to
+// segment files in the directory and the read position is synced to the
+// cursor file after each record shifted, so that the records are not shifted
+// again across restarts. It is safe for concurrent use.
+type Spool struct {
+	dir  string
+	opts SpoolOptions
+
+	// shiftMu serializes the readers so a record is shifted only once
+	shiftMu sync.Mutex
+
+	mu       sync.Mutex
+	closed   bool
+	segments []uint64
+	size     int64
+	w        *os.File
+	wseq     uint64
+	wsize    int64
+	r        *os.File
+	rseq     uint64
+	roff     int64
+	notify   chan struct{}
+}
+
+var (
+	spoolsMu sync.Mutex
+	// spools are the opened spools by directory
+	spools = map[string]*Spool{}
+)
+
+// NewSpool opens the spool in the directory, the records left by the
+// previous process are read first
+func NewSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	if opts.SegmentSize < 0 || opts.MaxSize < 0 {
+		return nil, errors.New("spool options must not be negative")
+	}
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = DefaultSpoolSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:    dir,
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[uint64]int64{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seq)
+		sizes[seq] = info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i] < s.segments[j]
+	})
+
+	if err = s.loadCursor(); err != nil {
+		return nil, err
+	}
+	// the segments before the cursor were consumed but not removed yet
+	for len(s.segments) > 0 && s.segments[0] < s.rseq {
+		if err = os.Remove(s.segmentName(s.segments[0])); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 || s.segments[0] != s.rseq {
+		s.roff = 0
+	}
+	for _, seq := range s.segments {
+		s.size += sizes[seq]
+	}
+	if len(s.segments) > 0 {
+		s.wseq = s.segments[len(s.segments)-1]
+	}
+	return s, nil
+}
+
+// openSpool returns the spool for the directory, spools are shared between
+// agent hooks so that a directory is only written by one spool
+func openSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	spoolsMu.Lock()
+	defer spoolsMu.Unlock()
+
+	if s, ok := spools[dir]; ok {
+		return s, nil
+	}
+	s, err := NewSpool(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	spools[dir] = s
+	return s, nil
+}
+
+// spoolOptions returns the spool options of the agent config
+func (c *AgentConfig) spoolOptions() SpoolOptions {
+	return SpoolOptions{
+		MaxSize: int64(c.SpoolSize) * 1024 * 1024,
+	}
+}
+
+// Dir returns the directory of the spool
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Size returns the size in bytes of all the segment files
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Empty checks whether all the records are shifted
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.empty()
+}
+
+// Append adds the record to the end of the spool, ErrSpoolFull is returned
+// if the spool reached its MaxSize
+func (s *Spool) Append(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	buf := appendRecord(nil, b)
+	n := int64(len(buf))
+	if s.opts.MaxSize > 0 && s.size+n > s.opts.MaxSize {
+		return ErrSpoolFull
+	}
+	if s.w == nil || (s.wsize > 0 && s.wsize+n > s.opts.SegmentSize) {
+		if err := s.nextSegment(); err != nil {
+			return err
+		}
+	}
+	written, err := s.w.Write(buf)
+	s.wsize += int64(written)
+	s.size += int64(written)
+	if err != nil {
+		return err
+	}
+	s.notifyAppended()
+	return nil
+}
+
+// Prepend adds the records in front of the spool in order, eg: the records
+// taken from the spool order by a closing agent hook, ErrSpoolFull is
+// returned if the spool reached its MaxSize
+func (s *Spool) Prepend(records [][]byte) error {
+	// the records peeked by the readers are moved
+	s.shiftMu.Lock()
+	defer s.shiftMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	var buf []byte
+	for _, b := range records {
+		buf = appendRecord(buf, b)
+	}
+	n := int64(len(buf))
+	if s.opts.MaxSize > 0 && s.size+n > s.opts.MaxSize {
+		return ErrSpoolFull
+	}
+	if len(s.segments) == 0 {
+		if err := s.nextSegment(); err != nil {
+			return err
+		}
+	}
+
+	// rewrite the oldest segment with the records inserted at the cursor, so
+	// the cursor is kept and the segment is read from the records whether
+	// it is replaced or not before a crash
+	seq := s.segments[0]
+	name := s.segmentName(seq)
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var off int64
+	if s.rseq == seq {
+		off = s.roff
+		if off > int64(len(b)) {
+			off = int64(len(b))
+		}
+	}
+	if s.rseq != seq {
+		s.rseq, s.roff = seq, 0
+	}
+	content := make([]byte, 0, len(b)+len(buf))
+	content = append(append(append(content, b[:off]...), buf...), b[off:]...)
+	tmp := name + ".tmp"
+	if err = writeFileSync(tmp, content); err != nil {
+		return err
+	}
+	if s.r != nil {
+		s.r.Close()
+		s.r = nil
+	}
+	writing := s.w != nil && s.wseq == seq
+	if writing {
+		s.w.Close()
+		s.w = nil
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return err
+	}
+	if err = syncDir(s.dir); err != nil {
+		return err
+	}
+	s.size += n
+	if writing {
+		if s.w, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return err
+		}
+		s.wsize = int64(len(content))
+	}
+	s.notifyAppended()
+	return nil
+}
+
+// appendRecord appends the record with the length header to buf
+func appendRecord(buf, b []byte) []byte {
+	var header [spoolHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(b)))
+	buf = append(buf, header[:]...)
+	return append(buf, b...)
+}
+
+// notifyAppended wakes up a reader waiting for the records
+func (s *Spool) notifyAppended() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Shift calls fn with the oldest record, the record is removed and the
+// cursor is synced if fn returns true, eg: after the record is written to
+// the agent. It returns false if the spool is empty or fn returns false.
+func (s *Spool) Shift(fn func(b []byte) bool) (bool, error) {
+	s.shiftMu.Lock()
+	defer s.shiftMu.Unlock()
+
+	s.mu.Lock()
+	b, next, err := s.peek()
+	s.mu.Unlock()
+	if b == nil || err != nil {
+		return false, err
+	}
+	if !fn(b) {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roff = next
+	return true, s.saveCursor()
+}
+
+// Close closes the segment files, the records not shifted are kept for
+// the next NewSpool
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	if s.w != nil {
+		if err := s.w.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := s.w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		s.w = nil
+	}
+	if s.r != nil {
+		if err := s.r.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		s.r = nil
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Spool) empty() bool {
+	switch len(s.segments) {
+	case 0:
+		return true
+	case 1:
+		return s.w != nil && s.rseq == s.wseq && s.roff >= s.wsize
+	}
+	return false
+}
+
+// peek reads the oldest record and the offset after it, the consumed
+// segments are removed, a nil record is returned if the spool is empty
+func (s *Spool) peek() ([]byte, int64, error) {
+	for len(s.segments) > 0 {
+		if s.closed {
+			return nil, 0, os.ErrClosed
+		}
+		if s.rseq != s.segments[0] {
+			s.rseq = s.segments[0]
+			s.roff = 0
+		}
+		if s.r == nil {
+			f, err := os.Open(s.segmentName(s.rseq))
+			if err != nil {
+				return nil, 0, err
+			}
+			s.r = f
+		}
+
+		b, err := s.readRecord()
+		if err == nil {
+			return b, s.roff + int64(spoolHeaderSize+len(b)), nil
+		}
+		if err != io.EOF {
+			return nil, 0, err
+		}
+		if s.w != nil && s.rseq == s.wseq {
+			// the segment is still being written
+			return nil, 0, nil
+		}
+		if err = s.removeSegment(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return nil, 0, nil
+}
+
+// readRecord reads the record at the cursor, io.EOF is returned at the end
+// of the segment or at a record truncated by a crash
+func (s *Spool) readRecord() ([]byte, error) {
+	var header [spoolHeaderSize]byte
+	if _, err := s.r.ReadAt(header[:], s.roff); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	info, err := s.r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if s.roff+spoolHeaderSize+n > info.Size() {
+		return nil, io.EOF
+	}
+	b := make([]byte, n)
+	if _, err := s.r.ReadAt(b, s.roff+spoolHeaderSize); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// removeSegment deletes the oldest segment which is fully consumed
+func (s *Spool) removeSegment() error {
+	name := s.segmentName(s.segments[0])
+	if s.r != nil {
+		s.r.Close()
+		s.r = nil
+	}
+	info, err := os.Stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info != nil {
+		s.size -= info.Size()
+	}
+	s.segments = s.segments[1:]
+	if len(s.segments) > 0 {
+		s.rseq = s.segments[0]
+		s.roff = 0
+	}
+	return s.saveCursor()
+}
+
+// nextSegment creates a new segment for appending
+func (s *Spool) nextSegment() error {
+	if s.w != nil {
+		if err := s.w.Close(); err != nil {
+			return err
+		}
+		s.w = nil
+	}
+	seq := s.wseq + 1
+	f, err := os.OpenFile(s.segmentName(seq), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s.w = f
+	s.wseq = seq
+	s.wsize = 0
+	s.segments = append(s.segments, seq)
+	return nil
+}
+
+func (s *Spool) segmentName(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// loadCursor reads the persisted read position: the segment sequence and
+// the offset
+func (s *Spool) loadCursor() error {
+	b, err := os.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if _, err = fmt.Sscanf(string(b), "%d %d", &s.rseq, &s.roff); err != nil {
+		return fmt.Errorf("invalid spool cursor: %v", err)
+	}
+	return nil
+}
+
+// saveCursor persists the read position, the file is synced and replaced
+// atomically
+func (s *Spool) saveCursor() error {
+	name := filepath.Join(s.dir, spoolCursorFile)
+	tmp := name + ".tmp"
+	if err := writeFileSync(tmp, []byte(fmt.Sprintf("%d %d\n", s.rseq, s.roff))); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// writeFileSync writes the file and syncs it to the disk
+func writeFileSync(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncDir syncs the directory so a file renamed into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,212 @@
+package log_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func shiftAll(t *testing.T, s *log.Spool) []string {
+	var records []string
+	for {
+		ok, err := s.Shift(func(b []byte) bool {
+			records = append(records, string(b))
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return records
+		}
+	}
+}
+
+func shiftN(t *testing.T, s *log.Spool, n int) []string {
+	var records []string
+	for i := 0; i < n; i++ {
+		ok, err := s.Shift(func(b []byte) bool {
+			records = append(records, string(b))
+			return true
+		})
+		if err != nil || !ok {
+			t.Fatal(ok, err)
+		}
+	}
+	return records
+}
+
+func TestSpool(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opts := log.SpoolOptions{SegmentSize: 32, MaxSize: 1024}
+
+	s, err := log.NewSpool(dir, opts)
+	assert.NoError(err)
+	assert.True(s.Empty())
+	for i := 0; i < 10; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	assert.False(s.Empty())
+
+	// the record is kept if fn returns false
+	ok, err := s.Shift(func(b []byte) bool { return false })
+	assert.False(ok)
+	assert.NoError(err)
+	var records []string
+	for i := 0; i < 4; i++ {
+		ok, err = s.Shift(func(b []byte) bool {
+			records = append(records, string(b))
+			return true
+		})
+		assert.True(ok)
+		assert.NoError(err)
+	}
+	assert.Equal([]string{"record 0", "record 1", "record 2", "record 3"}, records)
+	assert.NoError(s.Close())
+
+	// continue from the cursor after restart
+	s, err = log.NewSpool(dir, opts)
+	assert.NoError(err)
+	assert.NoError(s.Append([]byte("record 10")))
+	records = shiftAll(t, s)
+	assert.Equal([]string{"record 4", "record 5", "record 6", "record 7",
+		"record 8", "record 9", "record 10"}, records)
+	assert.True(s.Empty())
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	assert.Len(segments, 1)
+	assert.NoError(s.Close())
+
+	s, err = log.NewSpool(dir, opts)
+	assert.NoError(err)
+	assert.Empty(shiftAll(t, s))
+	for {
+		if err = s.Append([]byte("full")); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(err, log.ErrSpoolFull)
+	assert.LessOrEqual(s.Size(), opts.MaxSize)
+	assert.NoError(s.Close())
+}
+
+func TestSpoolTruncated(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	s, err := log.NewSpool(dir, log.SpoolOptions{})
+	assert.NoError(err)
+	assert.NoError(s.Append([]byte("foo")))
+	assert.NoError(s.Append([]byte("bar")))
+	assert.NoError(s.Close())
+
+	// the record written partially by a crash is skipped
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	assert.Len(segments, 1)
+	info, err := os.Stat(segments[0])
+	assert.NoError(err)
+	assert.NoError(os.Truncate(segments[0], info.Size()-1))
+
+	s, err = log.NewSpool(dir, log.SpoolOptions{})
+	assert.NoError(err)
+	defer s.Close()
+	assert.NoError(s.Append([]byte("baz")))
+	assert.Equal([]string{"foo", "baz"}, shiftAll(t, s))
+}
+
+func TestSpooledAgentHook(t *testing.T) {
+	assert := assert.New(t)
+	s, err := log.NewSpool(t.TempDir(), log.SpoolOptions{})
+	assert.NoError(err)
+	defer s.Close()
+
+	agent := &agentRecorder{down: true}
+	formatter := &logrus.TextFormatter{DisableTimestamp: true}
+	hook := log.WrapAgentHook(agent, formatter, 1, s)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(hook)
+	for i := 0; i < 10; i++ {
+		l.Infof("agent %d", i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(hook.Close(ctx), context.DeadlineExceeded)
+	assert.Zero(hook.Dropped())
+	assert.False(s.Empty())
+
+	// the spooled entries are replayed in order once the agent is up
+	agent.setDown(false)
+	hook = log.WrapAgentHook(agent, formatter, 1, s)
+	l.ReplaceHooks(logrus.LevelHooks{})
+	l.AddHook(hook)
+	l.Info("agent 10")
+	assert.Eventually(func() bool {
+		return len(agent.messages()) == 11
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(hook.Close(context.Background()))
+
+	var expected []string
+	for i := 0; i <= 10; i++ {
+		expected = append(expected, fmt.Sprintf(`level=info msg="agent %d"`, i))
+	}
+	// the entries sending and queued when closing are put in front of the
+	// overflowed ones
+	assert.Equal(expected, agent.messages())
+	assert.True(s.Empty())
+}
+
+func TestSpoolPrepend(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opts := log.SpoolOptions{SegmentSize: 32}
+
+	s, err := log.NewSpool(dir, opts)
+	assert.NoError(err)
+	assert.NoError(s.Prepend([][]byte{[]byte("b")}))
+	assert.NoError(s.Prepend([][]byte{[]byte("a")}))
+	for i := 0; i < 6; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	assert.Equal([]string{"a", "b"}, shiftN(t, s, 2))
+	assert.Equal([]string{"record 0", "record 1"}, shiftN(t, s, 2))
+	// the shifted records are not replayed
+	assert.NoError(s.Prepend([][]byte{[]byte("c"), []byte("d")}))
+	assert.NoError(s.Append([]byte("record 6")))
+	assert.NoError(s.Close())
+
+	s, err = log.NewSpool(dir, opts)
+	assert.NoError(err)
+	defer s.Close()
+	assert.Equal([]string{"c", "d", "record 2", "record 3", "record 4",
+		"record 5", "record 6"}, shiftAll(t, s))
+	assert.True(s.Empty())
+}
+
+func TestSpoolCursorSynced(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opts := log.SpoolOptions{SegmentSize: 1024}
+
+	s, err := log.NewSpool(dir, opts)
+	assert.NoError(err)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		assert.NoError(s.Append([]byte(fmt.Sprintf("record %d", i))))
+	}
+	assert.Equal([]string{"record 0"}, shiftN(t, s, 1))
+
+	// the cursor is saved without closing, eg: the process is killed
+	s2, err := log.NewSpool(dir, opts)
+	assert.NoError(err)
+	defer s2.Close()
+	assert.Equal([]string{"record 1", "record 2"}, shiftAll(t, s2))
+}
@@ -0,0 +1,36 @@
+package log
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultStackDepth is the default maximum number of the frames captured
+const DefaultStackDepth = 32
+
+// parseStackLevel parses the stack level of the config, ok is false if the
+// stack is not captured
+func parseStackLevel(level string) (l logrus.Level, ok bool, err error) {
+	if level == "" {
+		return 0, false, nil
+	}
+	if l, err = logrus.ParseLevel(level); err != nil {
+		return 0, false, err
+	}
+	return l, true, nil
+}
+
+// StackEnabled checks whether the stack of the caller is captured for the
+// entries of level logged by the logger, see Config.StackLevel
+func StackEnabled(log *logrus.Logger, level logrus.Level) bool {
+	st := loadState(log)
+	return st != nil && st.stack && st.stackLevel >= level
+}
+
+// StackDepth returns the maximum number of the frames captured by the
+// logger, see Config.StackDepth
+func StackDepth(log *logrus.Logger) int {
+	if st := loadState(log); st != nil {
+		return st.stackDepth
+	}
+	return DefaultStackDepth
+}
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// AgentWarnOutput is where the warnings of dropping entries are written
+	AgentWarnOutput io.Writer = os.Stderr
+	// AgentWarnInterval is the minimum interval between the warnings of
+	// dropping entries of an agent hook
+	AgentWarnInterval = time.Minute
+)
+
+// AgentStats is the shipping statistics of an agent hook
+type AgentStats struct {
+	// Enqueued is the count of the entries queued into the channel
+	Enqueued uint64 `json:"enqueued"`
+	// Spooled is the count of the entries appended to the spool
+	Spooled uint64 `json:"spooled"`
+	// Sent is the count of the entries written to the agent connection
+	Sent uint64 `json:"sent"`
+	// Dropped is the count of the entries dropped as the channel was full,
+	// the agent was unreachable when closing or the hook was closed
+	Dropped uint64 `json:"dropped"`
+	// Reconnects is the count of the connections made after failing to dial
+	// or write to the agent
+	Reconnects uint64 `json:"reconnects"`
+	// LastError is the last error of dialing or writing to the agent
+	LastError string `json:"last_error,omitempty"`
+	// QueueDepth is the count of the entries in the channel waiting to be
+	// written
+	QueueDepth int `json:"queue_depth"`
+	// QueueSize is the capacity of the channel, ie: ChannelSize
+	QueueSize int `json:"queue_size"`
+}
+
+var publishOnce sync.Once
+
+// publishAgentStats publishes the stats of the agent hook installed by
+// InitLog as the log_agent expvar, unless the name is taken already
+func publishAgentStats() {
+	publishOnce.Do(func() {
+		if expvar.Get("log_agent") != nil {
+			return
+		}
+		expvar.Publish("log_agent", expvar.Func(func() interface{} {
+			return GetAgentStats()
+		}))
+	})
+}
+
+// GetAgentStats returns the stats of the agent hook installed by InitLog, it
+// is published as the log_agent expvar once the agent hook is created,
+// the stats are all zero if the agent is disabled
+func GetAgentStats() AgentStats {
+	agentMu.Lock()
+	h := agentHook
+	agentMu.Unlock()
+	if h == nil {
+		return AgentStats{}
+	}
+	return h.Stats()
+}
+
+// Stats returns the shipping statistics of the hook
+func (h *AgentHook) Stats() AgentStats {
+	h.errMu.Lock()
+	lastErr := h.lastErr
+	h.errMu.Unlock()
+	return AgentStats{
+		Enqueued:   atomic.LoadUint64(&h.enqueued),
+		Spooled:    atomic.LoadUint64(&h.spooled),
+		Sent:       atomic.LoadUint64(&h.sent),
+		Dropped:    atomic.LoadUint64(&h.dropped),
+		Reconnects: atomic.LoadUint64(&h.reconnects),
+		LastError:  lastErr,
+		QueueDepth: len(h.ch),
+		QueueSize:  cap(h.ch),
+	}
+}
+
+// setError records the last error of dialing or writing to the agent
+func (h *AgentHook) setError(err error) {
+	// the error may contain the address with password
+	msg := GetRedactor().RedactString(err.Error())
+	h.errMu.Lock()
+	h.lastErr = msg
+	h.errMu.Unlock()
+}
+
+// drop counts the dropped entry and warns at most once per AgentWarnInterval
+func (h *AgentHook) drop() {
+	dropped := atomic.AddUint64(&h.dropped, 1)
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&h.lastWarn)
+	if last != 0 && now-last < int64(AgentWarnInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&h.lastWarn, last, now) {
+		return
+	}
+	stats := h.Stats()
+	msg := fmt.Sprintf("log agent dropped %d entries, queue %d/%d",
+		dropped, stats.QueueDepth, stats.QueueSize)
+	if stats.LastError != "" {
+		msg += ", last error: " + stats.LastError
+	}
+	fmt.Fprintln(AgentWarnOutput, msg)
+}
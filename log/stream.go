@@ -0,0 +1,279 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// streamState is the state of a stream logger built by a config: the hooks,
+// formatter and output, the level, the vmodule rules, the stack level and
+// the redactor. It is never modified but replaced as a whole, so an entry is
+// handled by the state of a single config.
+type streamState struct {
+	formatter  logrus.Formatter
+	out        io.Writer
+	hooks      logrus.LevelHooks
+	level      logrus.Level
+	modules    *moduleRules
+	stackLevel logrus.Level
+	stackDepth int
+	stack      bool
+	redactor   *Redactor
+}
+
+// stream is the first hook of a stream logger, it handles the entries by its
+// current state: the entries disabled by the level and the vmodule rules are
+// dropped, the others are passed to the hooks of the state. The logger writes
+// the entries to the output of the state formatted by the formatter of the
+// state, its level is the most verbose level of the state to filter the
+// entries beforehand.
+// The output, formatter and level set by the logrus setters are used until
+// the state is replaced by InitLog or SetLogOut, the level set by SetLevel
+// becomes the level of the state.
+type stream struct {
+	log       *logrus.Logger
+	state     atomic.Value // *streamState
+	formatter *streamFormatter
+	// level is the logger level set by the state
+	level uint32
+}
+
+// streamFormatter formats the entries of a stream logger by the state
+// handling them
+type streamFormatter struct {
+	s *stream
+}
+
+// stateKey is the context key of the state handling the entry
+type stateKey struct{}
+
+var (
+	// stateMu serializes the replacements of the states
+	stateMu sync.Mutex
+	// loggerStreams stores the streams of the stream loggers by logger
+	loggerStreams sync.Map
+
+	// discardLogger writes the entries dropped by the stream to nowhere
+	discardLogger = &logrus.Logger{
+		Out:       io.Discard,
+		Formatter: NewEmptyFormatter(),
+		Hooks:     make(logrus.LevelHooks),
+	}
+)
+
+// attachStream makes the logger a stream logger handled by the state, the
+// hooks, formatter and output of the logger are replaced
+func attachStream(log *logrus.Logger, st *streamState) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	s := &stream{log: log}
+	s.formatter = &streamFormatter{s: s}
+	log.ReplaceHooks(logrus.LevelHooks{})
+	s.swap(st)
+	loggerStreams.Store(log, s)
+}
+
+// detachStream stops tracking the stream logger, it keeps logging by its
+// last state
+func detachStream(log *logrus.Logger) {
+	loggerStreams.Delete(log)
+}
+
+// getStream returns the stream of the logger, nil if it is not a stream
+// logger
+func getStream(log *logrus.Logger) *stream {
+	if v, ok := loggerStreams.Load(log); ok {
+		return v.(*stream)
+	}
+	return nil
+}
+
+// swapState replaces the state of the stream logger and resets its output
+// and formatter
+func swapState(log *logrus.Logger, st *streamState) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if s := getStream(log); s != nil {
+		s.swap(st)
+	}
+}
+
+// updateState replaces the state of the stream logger by a copy modified by
+// fn, it returns false if the logger is not a stream logger
+func updateState(log *logrus.Logger, fn func(st *streamState)) bool {
+	s := getStream(log)
+	if s == nil {
+		return false
+	}
+	s.adoptLevel()
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := *s.load()
+	fn(&st)
+	s.store(&st)
+	return true
+}
+
+// loadState returns the state of the stream logger, nil if it is not a
+// stream logger
+func loadState(log *logrus.Logger) *streamState {
+	if s := getStream(log); s != nil {
+		s.adoptLevel()
+		return s.load()
+	}
+	return nil
+}
+
+// liveStates returns the states of all the stream loggers
+func liveStates() []*streamState {
+	var states []*streamState
+	loggerStreams.Range(func(key, value interface{}) bool {
+		states = append(states, value.(*stream).load())
+		return true
+	})
+	return states
+}
+
+func (s *stream) load() *streamState {
+	return s.state.Load().(*streamState)
+}
+
+// swap replaces the state with stateMu held, the stream hook is added back
+// if it is removed, eg: by ReplaceHooks. The output is replaced before the
+// state, so the entries handled by the previous state may be written to the
+// new output, but nothing is written to the previous output after swapping.
+func (s *stream) swap(st *streamState) {
+	if !s.hooked() {
+		s.log.AddHook(s)
+	}
+	s.log.SetFormatter(s.formatter)
+	s.log.SetOutput(st.out)
+	s.store(st)
+}
+
+// store replaces the state with stateMu held, the logger level only filters
+// the entries before the state, so it is lowered first to not drop the
+// entries enabled by the new state
+func (s *stream) store(st *streamState) {
+	level := st.effectiveLevel()
+	if level > s.log.GetLevel() {
+		s.log.SetLevel(level)
+	}
+	s.state.Store(st)
+	atomic.StoreUint32(&s.level, uint32(level))
+	s.log.SetLevel(level)
+}
+
+// adoptLevel makes the level set by the logrus SetLevel the level of the
+// state
+func (s *stream) adoptLevel() {
+	if uint32(s.log.GetLevel()) == atomic.LoadUint32(&s.level) {
+		return
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	level := s.log.GetLevel()
+	if uint32(level) == atomic.LoadUint32(&s.level) {
+		return
+	}
+	st := *s.load()
+	st.level = level
+	s.store(&st)
+}
+
+// hooked checks whether the stream is a hook of the logger
+func (s *stream) hooked() bool {
+	for _, hook := range s.log.Hooks[logrus.PanicLevel] {
+		if hook == logrus.Hook(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Levels returns all the levels
+func (s *stream) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire handles the entry by the current state, the entry enabled by the
+// level and the vmodule rules is passed to the hooks of the state and
+// formatted by the formatter of the state, the others are written to
+// nowhere. The errors of the hooks are reported to stderr like logrus does.
+func (s *stream) Fire(entry *logrus.Entry) error {
+	s.adoptLevel()
+	st := s.load()
+	if !st.enabled(entry) {
+		entry.Logger = discardLogger
+		return nil
+	}
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry.Context = context.WithValue(ctx, stateKey{}, st)
+
+	for _, hook := range st.hooks[entry.Level] {
+		if err := hook.Fire(entry); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to fire hook:", err)
+			break
+		}
+	}
+	return nil
+}
+
+// Format formats the entry by the state handling it, or by the current
+// state if the stream hook is removed from the logger
+func (f *streamFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	st := entryState(entry)
+	if st == nil {
+		if st = f.s.load(); !st.enabled(entry) {
+			return nil, nil
+		}
+	}
+	return st.formatter.Format(entry)
+}
+
+// entryState returns the state handling the entry if any
+func entryState(entry *logrus.Entry) *streamState {
+	if entry.Context == nil {
+		return nil
+	}
+	st, _ := entry.Context.Value(stateKey{}).(*streamState)
+	return st
+}
+
+// effectiveLevel returns the most verbose level of the level and the
+// vmodule rules
+func (st *streamState) effectiveLevel() logrus.Level {
+	if st.modules != nil && st.modules.maxLevel > st.level {
+		return st.modules.maxLevel
+	}
+	return st.level
+}
+
+// enabled checks whether the entry is enabled for its caller
+func (st *streamState) enabled(entry *logrus.Entry) bool {
+	if st.modules == nil || len(st.modules.rules) == 0 {
+		return st.level >= entry.Level
+	}
+	file, _, _ := EntryCaller(entry)
+	return st.levelEnabled(entry.Level, file)
+}
+
+// levelEnabled checks whether the level is enabled for the caller file by
+// the vmodule rules, or by the level if no rule matches
+func (st *streamState) levelEnabled(level logrus.Level, file string) bool {
+	if file != "" && st.modules != nil {
+		if match := st.modules.lookup(file); match.ok {
+			return match.level >= level
+		}
+	}
+	return st.level >= level
+}
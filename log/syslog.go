@@ -0,0 +1,277 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslog protocols
+const (
+	RFC5424 = "5424"
+	RFC3164 = "3164"
+)
+
+const syslogDialTimeout = 5 * time.Second
+
+// SyslogSDID is the SD-ID of the structured data element contains the fields
+var SyslogSDID = "fields@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogFormatter formats the entry as a RFC 5424 or RFC 3164 syslog message,
+// the fields are the SD-PARAMs of RFC 5424 message, or appended to the
+// message as key=value for RFC 3164
+type SyslogFormatter struct {
+	RFC      string
+	Facility int
+	Hostname string
+	AppName  string
+}
+
+// SyslogWriter sends each write as a syslog message, the messages are framed
+// by octet counting over TCP, it reconnects on write errors
+type SyslogWriter struct {
+	mu      sync.Mutex
+	network string
+	address string
+	conn    net.Conn
+}
+
+// NewSyslogOutput creates the syslog writer and formatter by the dsn,
+// eg: syslog://127.0.0.1:514 (udp), syslog+tcp://127.0.0.1:601 or
+// unixgram:///dev/log, the query parameters are facility (default user) and
+// rfc (5424 or 3164, default 5424)
+func NewSyslogOutput(dsn string) (*SyslogWriter, *SyslogFormatter, error) {
+	return newSyslogOutput(conf, dsn)
+}
+
+func newSyslogOutput(c *Config, dsn string) (*SyslogWriter, *SyslogFormatter, error) {
+	w, f, err := parseSyslogDSN(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c != nil {
+		f.Hostname = c.Agent.Host
+		f.AppName = c.Agent.AppID
+	}
+	if f.Hostname == "" {
+		f.Hostname, _ = os.Hostname()
+	}
+	if f.AppName == "" {
+		f.AppName = filepath.Base(os.Args[0])
+	}
+
+	// connect at first to report the errors early
+	if err = w.connect(); err != nil {
+		return nil, nil, err
+	}
+	return w, f, nil
+}
+
+// parseSyslogDSN returns the writer and formatter not connected yet
+func parseSyslogDSN(dsn string) (*SyslogWriter, *SyslogFormatter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &SyslogWriter{}
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		w.network, w.address = "udp", u.Host
+	case "syslog+tcp":
+		w.network, w.address = "tcp", u.Host
+	case "unixgram":
+		w.network, w.address = "unixgram", u.Path
+	default:
+		return nil, nil, fmt.Errorf("unsupported syslog network: %q", u.Scheme)
+	}
+	if w.address == "" {
+		return nil, nil, errors.New("empty syslog address")
+	}
+
+	f := &SyslogFormatter{RFC: RFC5424, Facility: syslogFacilities["user"]}
+	q := u.Query()
+	if facility := q.Get("facility"); facility != "" {
+		var ok bool
+		if f.Facility, ok = syslogFacilities[facility]; !ok {
+			if f.Facility, err = strconv.Atoi(facility); err != nil || f.Facility < 0 || f.Facility > 23 {
+				return nil, nil, fmt.Errorf("unknown syslog facility: %q", facility)
+			}
+		}
+	}
+	if rfc := q.Get("rfc"); rfc != "" {
+		if rfc != RFC5424 && rfc != RFC3164 {
+			return nil, nil, fmt.Errorf("unknown syslog rfc: %q", rfc)
+		}
+		f.RFC = rfc
+	}
+	return w, f, nil
+}
+
+// Write sends the message and reconnects once on error
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	if w.network == "tcp" {
+		// octet counting framing, RFC 6587
+		p = append([]byte(strconv.Itoa(len(p))+" "), p...)
+	}
+	var err error
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write(p); err == nil {
+			return n, nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the connection
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, syslogDialTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Format renders the entry as a syslog message
+// eg: <14>1 2019-01-31T04:48:20.259Z host app 123 - [fields@32473 key="value"] [controllers/aibf/character.go:99] foo
+func (f *SyslogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fields := EntryFields(entry)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var message string
+	if file, line, ok := EntryCaller(entry); ok {
+		message = fmt.Sprintf("[%s:%d] ", file, line)
+	}
+	message += EntryRedactor(entry).RedactString(entry.Message)
+
+	b := &bytes.Buffer{}
+	pri := f.Facility*8 + syslogSeverity(entry.Level)
+	if f.RFC == RFC3164 {
+		fmt.Fprintf(b, "<%d>%s %s %s[%d]: %s", pri, entry.Time.Format(time.Stamp),
+			f.Hostname, f.AppName, os.Getpid(), message)
+		for _, k := range keys {
+			fmt.Fprintf(b, " %s=%v", k, fields[k])
+		}
+		return b.Bytes(), nil
+	}
+
+	fmt.Fprintf(b, "<%d>1 %s %s %s %d - ", pri, entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeader(f.Hostname, 255), syslogHeader(f.AppName, 48), os.Getpid())
+	if len(keys) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + SyslogSDID)
+		for _, k := range keys {
+			b.WriteString(" " + syslogParamName(k) + `="`)
+			syslogParamValueEscaper.WriteString(b, fmt.Sprint(fields[k]))
+			b.WriteString(`"`)
+		}
+		b.WriteString("]")
+	}
+	if message != "" {
+		b.WriteString(" " + message)
+	}
+	return b.Bytes(), nil
+}
+
+var syslogParamValueEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogSeverity converts the level to syslog severity
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // critical
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	}
+	return 7 // debug
+}
+
+// syslogHeader returns the header field with printable ASCII characters
+// and at most n characters, or the nil value
+func syslogHeader(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > n {
+		s = s[:n]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// syslogParamName returns the valid SD-NAME of the field key
+func syslogParamName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// isSyslogOutput checks whether the output path is a syslog dsn
+func isSyslogOutput(path string) bool {
+	return strings.HasPrefix(path, "syslog://") || strings.HasPrefix(path, "syslog+") ||
+		strings.HasPrefix(path, "unixgram://")
+}
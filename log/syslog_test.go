@@ -0,0 +1,98 @@
+//go:build !windows
+
+package log_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+)
+
+func listenUnixgram(t *testing.T, path string) *net.UnixConn {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readDatagram(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogOutput(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn := listenUnixgram(t, path)
+
+	conf := newTestConfig()
+	conf.ErrorLog = "unixgram://" + path + "?facility=local0"
+	conf.Agent.AppID = "tgo"
+	conf.Agent.Host = "localhost"
+	assert.NoError(log.InitLog(conf))
+
+	log.LogError.WithField("user", `a "b"]`).Error("foo")
+	assert.Regexp(`^<131>1 \S+Z localhost tgo \d+ - \[fields@32473 user="a \\"b\\"\\]"\] foo$`, readDatagram(t, conn))
+
+	// reconnect after the listener restarted
+	conn.Close()
+	assert.NoError(os.Remove(path))
+	conn = listenUnixgram(t, path)
+	defer conn.Close()
+	log.LogError.Error("bar")
+	assert.Regexp(`^<131>1 \S+ localhost tgo \d+ - - bar$`, readDatagram(t, conn))
+
+	w, f, err := log.NewSyslogOutput("unixgram://" + path + "?rfc=3164")
+	assert.NoError(err)
+	defer w.Close()
+	l := logrus.New()
+	l.Out, l.Formatter = w, f
+	l.WithField("user", "foo").Warn("baz")
+	assert.Regexp(`^<12>\w{3} [ \d]\d \d\d:\d\d:\d\d localhost tgo\[\d+\]: baz user=foo$`, readDatagram(t, conn))
+
+	_, _, err = log.NewSyslogOutput("unixgram://" + path + "?facility=foo")
+	assert.Error(err)
+	_, _, err = log.NewSyslogOutput("unixgram://" + path + "?rfc=1")
+	assert.Error(err)
+}
+
+func TestSyslogWriterTCP(t *testing.T) {
+	assert := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w, _, err := log.NewSyslogOutput("syslog+tcp://" + ln.Addr().String())
+	assert.NoError(err)
+	defer w.Close()
+	n, err := w.Write([]byte("hello"))
+	assert.NoError(err)
+	// the length of the framing is not counted
+	assert.Equal(5, n)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(err)
+	assert.Equal("5 hello", string(buf))
+}
@@ -0,0 +1,227 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxChannelSize is the maximum channel size of the agent hook
+const MaxChannelSize = 1 << 20
+
+// FieldError is the error of a config field addressed by its yaml path,
+// eg: agent.dsn or outputs[0].level
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+// Error returns the path and the error
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the field
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is all the field errors found by Config.Validate
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error returns all the field errors in one line
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid log config: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the field errors
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (e *ValidationError) add(path string, err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, &FieldError{Path: path, Err: err})
+	}
+}
+
+// Validate checks all the fields of the config, the returned error is a
+// *ValidationError reports all the invalid fields
+func (c *Config) Validate() error {
+	e := &ValidationError{}
+	e.add("format", validateFormat(c.Format))
+	e.add("access_log", validateOutput(c.AccessLog))
+	e.add("access_level", validateLevel(c.AccessLevel))
+	e.add("error_log", validateOutput(c.ErrorLog))
+	e.add("error_level", validateLevel(c.ErrorLevel))
+	if _, err := parseVModule(c.VModule); err != nil {
+		e.add("vmodule", err)
+	}
+	if _, _, err := parseStackLevel(c.StackLevel); err != nil {
+		e.add("stack_level", err)
+	}
+	e.add("stack_depth", validateNonNegative(c.StackDepth))
+	e.add("max_size", validateNonNegative(c.MaxSize))
+	if err := (RotateOptions{Every: c.Rotate}).validate(); err != nil {
+		e.add("rotate", err)
+	}
+	e.add("max_backups", validateNonNegative(c.MaxBackups))
+	e.add("max_age", validateNonNegative(c.MaxAge))
+
+	for i, o := range c.Outputs {
+		prefix := fmt.Sprintf("outputs[%d].", i)
+		switch o.Stream {
+		case StreamAccess, StreamError:
+		default:
+			e.add(prefix+"stream", fmt.Errorf("unknown stream: %q", o.Stream))
+		}
+		if o.Path == "" {
+			e.add(prefix+"path", errors.New("empty output path"))
+		} else {
+			e.add(prefix+"path", validateOutput(o.Path))
+		}
+		if o.Level != "" {
+			e.add(prefix+"level", validateLevel(o.Level))
+		}
+		if o.Format != "" {
+			e.add(prefix+"format", validateFormat(o.Format))
+		}
+	}
+
+	switch c.Redact.Mode {
+	case "", RedactMask, RedactHash, RedactDrop:
+	default:
+		e.add("redact.mode", fmt.Errorf("unknown redact mode: %q", c.Redact.Mode))
+	}
+	for i, pattern := range c.Redact.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			e.add(fmt.Sprintf("redact.patterns[%d]", i), err)
+		}
+	}
+
+	if c.Agent.Enabled || c.Agent.DSN != "" {
+		if c.Agent.DSN == "" {
+			e.add("agent.dsn", errors.New("empty agent dsn"))
+		} else if _, _, err := parseAgentDSN(c.Agent.DSN); err != nil {
+			e.add("agent.dsn", err)
+		}
+	}
+	if c.Agent.ChannelSize < 0 || c.Agent.ChannelSize > MaxChannelSize {
+		e.add("agent.channel_size", fmt.Errorf("channel size must be between 0 and %d", MaxChannelSize))
+	}
+	if c.Agent.SpoolDir != "" {
+		e.add("agent.spool_dir", validateDir(c.Agent.SpoolDir))
+	}
+	e.add("agent.spool_size", validateNonNegative(c.Agent.SpoolSize))
+
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+func validateFormat(format string) error {
+	_, err := NewFormatter(format)
+	return err
+}
+
+func validateLevel(level string) error {
+	_, err := logrus.ParseLevel(level)
+	return err
+}
+
+func validateNonNegative(n int) error {
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// validateOutput checks the output without opening it, the directory of a
+// file output must exist and be writable as it is not created
+func validateOutput(output string) error {
+	switch output {
+	case "", "stdout", "stderr":
+		return nil
+	}
+	if isSyslogOutput(output) {
+		_, _, err := parseSyslogDSN(output)
+		return err
+	}
+	if isJournalOutput(output) {
+		_, err := url.Parse(output)
+		return err
+	}
+	info, err := os.Stat(output)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", output)
+		}
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	dir := filepath.Dir(output)
+	info, err = os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return validateWritable(dir)
+}
+
+// validateDir checks whether the directory or its nearest existing parent
+// is writable, the missing directories are created by the spool
+func validateDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	return validateWritable(dir)
+}
+
+// validateWritable checks whether a file can be created in the directory
+func validateWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".tgo-log-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// moduleRule is a level rule for the caller files matching the pattern
+type moduleRule struct {
+	pattern string
+	level   logrus.Level
+}
+
+// moduleRules are the parsed vmodule rules with the matching results cache
+type moduleRules struct {
+	rules []moduleRule
+	// maxLevel is the most verbose level in rules
+	maxLevel logrus.Level
+	// cache stores the *moduleMatch by caller file
+	cache sync.Map
+}
+
+type moduleMatch struct {
+	level logrus.Level
+	ok    bool
+}
+
+// SetVModule sets the level rules by caller file path of LogAccess and
+// LogError, the rules are comma separated pattern=level pairs,
+// eg: controllers/payment/...=debug,models/*=warn
+// the pattern is matched against the project relative path of the caller file
+// with or without the .go extension, or the file name if the pattern contains
+// no slash, the pattern ending with /... matches the files in the directories
+// matching the rest of the pattern and their subdirectories.
+// The logrus level of the loggers is lowered to the most verbose level of the
+// rules, and the rules apply to all the entries of the loggers, including the
+// ones logged by the logrus loggers directly. The entries without the caller,
+// eg: logged directly without ReportCaller, are filtered by the access or
+// error level.
+func SetVModule(spec string) error {
+	m, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+	for _, log := range []*logrus.Logger{LogAccess, LogError} {
+		updateState(log, func(st *streamState) {
+			st.modules = m
+		})
+	}
+	return nil
+}
+
+// parseVModule parses the vmodule spec into the level rules
+func parseVModule(spec string) (*moduleRules, error) {
+	m := &moduleRules{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndexByte(item, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid vmodule rule: %q", item)
+		}
+		pattern := strings.TrimSpace(item[:i])
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/..."), ""); err != nil {
+			return nil, fmt.Errorf("invalid vmodule pattern %q: %v", pattern, err)
+		}
+		level, err := logrus.ParseLevel(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, moduleRule{pattern: pattern, level: level})
+		if level > m.maxLevel {
+			m.maxLevel = level
+		}
+	}
+	return m, nil
+}
+
+// LevelEnabled checks whether the level is enabled for the caller file by the
+// vmodule rules, or by the logger level if no rule matches
+func LevelEnabled(log *logrus.Logger, level logrus.Level, file string) bool {
+	if st := loadState(log); st != nil {
+		return st.levelEnabled(level, file)
+	}
+	return log.IsLevelEnabled(level)
+}
+
+// lookup returns the level of the first rule matching the file, the results
+// are cached
+func (m *moduleRules) lookup(file string) *moduleMatch {
+	if v, ok := m.cache.Load(file); ok {
+		return v.(*moduleMatch)
+	}
+	match := m.match(file)
+	m.cache.Store(file, match)
+	return match
+}
+
+// match returns the level of the first rule matching the file
+func (m *moduleRules) match(file string) *moduleMatch {
+	name := strings.TrimSuffix(file, ".go")
+	for _, rule := range m.rules {
+		if dir, ok := strings.CutSuffix(rule.pattern, "/..."); ok {
+			if matchDir(dir, file) {
+				return &moduleMatch{level: rule.level, ok: true}
+			}
+			continue
+		}
+		target := name
+		if !strings.Contains(rule.pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(rule.pattern, file); ok {
+			return &moduleMatch{level: rule.level, ok: true}
+		}
+		if ok, _ := path.Match(rule.pattern, target); ok {
+			return &moduleMatch{level: rule.level, ok: true}
+		}
+	}
+	return &moduleMatch{}
+}
+
+// matchDir checks whether the file is in a directory matching the pattern or
+// in its subdirectories
+func matchDir(pattern, file string) bool {
+	n := strings.Count(pattern, "/") + 1
+	segments := strings.Split(file, "/")
+	if len(segments) <= n {
+		return false
+	}
+	ok, _ := path.Match(pattern, strings.Join(segments[:n], "/"))
+	return ok
+}
+
+// setLevel sets the level of logger, the level of a stream logger is set to
+// its state, and the logger level may be lowered by the vmodule rules
+func setLevel(log *logrus.Logger, level logrus.Level) {
+	ok := updateState(log, func(st *streamState) {
+		st.level = level
+	})
+	if !ok {
+		log.SetLevel(level)
+	}
+}
+
+// getLevel returns the level set by setLevel
+func getLevel(log *logrus.Logger) logrus.Level {
+	if st := loadState(log); st != nil {
+		return st.level
+	}
+	return log.GetLevel()
+}
@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tengattack/tgo/log"
+	"golang.org/x/term"
+)
+
+// FormatConsole is the format name of ConsoleFormatter
+const FormatConsole = "console"
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorDim    = "\x1b[2m"
+	colorRed    = 31
+	colorGreen  = 32
+	colorYellow = 33
+	colorBlue   = 36
+	colorGray   = 37
+)
+
+// ConsoleFormatter defines the colorized format for developer console,
+// it outputs the same as LogFileFormatter if the output is not a terminal
+// or the NO_COLOR environment variable is set to a non-empty value
+// eg: 2019-01-31T04:48:20 INFO  [controllers/aibf/character.go:99] foo      key=value
+type ConsoleFormatter struct {
+	LogFileFormatter
+
+	// ForceColors enables colors even if the output is not a terminal
+	ForceColors bool
+	// MessageWidth is the width the message is padded to for aligning fields
+	MessageWidth int
+}
+
+// terminals caches whether the output files are terminal
+var terminals sync.Map
+
+// NewConsoleFormatter return the colorized format for developer console
+func NewConsoleFormatter() *ConsoleFormatter {
+	return &ConsoleFormatter{
+		LogFileFormatter: *newLogFileFormatter(),
+		MessageWidth:     44,
+	}
+}
+
+// Format renders a single log entry for console
+func (f *ConsoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.isColored(entry) {
+		return f.LogFileFormatter.Format(entry)
+	}
+
+	data := getData(entry)
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	if !f.DisableSorting {
+		if nil != f.SortingFunc {
+			f.SortingFunc(keys)
+		} else {
+			sort.Strings(keys)
+		}
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339
+	}
+
+	var b *bytes.Buffer
+	if entry.Buffer != nil {
+		b = entry.Buffer
+	} else {
+		b = &bytes.Buffer{}
+	}
+	levelColor := getLevelColor(entry.Level)
+	fmt.Fprintf(b, "%s%s%s \x1b[%dm%-5s%s", colorDim, entry.Time.Format(timestampFormat), colorReset,
+		levelColor, getLevelString(entry.Level), colorReset)
+	if caller := getCaller(entry); caller != nil {
+		fmt.Fprintf(b, " %s[%s:%d]%s", colorBold, caller.File, caller.Line, colorReset)
+	}
+	message := getMessage(entry)
+	if len(keys) > 0 {
+		fmt.Fprintf(b, " %-*s", f.MessageWidth, message)
+	} else if message != "" {
+		b.WriteString(" " + message)
+	}
+	for _, key := range keys {
+		fmt.Fprintf(b, " \x1b[%dm%s%s=", levelColor, key, colorReset)
+		appendValue(b, data[key], f.QuoteEmptyFields)
+	}
+	appendStack(b, entry)
+
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// isColored checks whether the entry should be colorized
+func (f *ConsoleFormatter) isColored(entry *logrus.Entry) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if f.ForceColors {
+		return true
+	}
+	out := log.EntryOutput(entry)
+	// the output may be wrapped, eg: counting the bytes written
+	for {
+		u, ok := out.(interface{ Unwrap() io.Writer })
+		if !ok {
+			break
+		}
+		out = u.Unwrap()
+	}
+	switch out := out.(type) {
+	case *os.File:
+		if out == os.Stdout {
+			return log.IsTerm
+		}
+		isTerm, ok := terminals.Load(out)
+		if !ok {
+			isTerm, _ = terminals.LoadOrStore(out, term.IsTerminal(int(out.Fd())))
+		}
+		return isTerm.(bool)
+	}
+	return false
+}
+
+// getLevelColor returns the ANSI color of the level
+func getLevelColor(level logrus.Level) int {
+	switch level {
+	case logrus.DebugLevel, logrus.TraceLevel:
+		return colorGray
+	case logrus.InfoLevel:
+		return colorBlue
+	case logrus.WarnLevel:
+		return colorYellow
+	case logrus.ErrorLevel, logrus.FatalLevel, logrus.PanicLevel:
+		return colorRed
+	}
+	return colorGreen
+}
@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tengattack/tgo/log"
+)
+
+// ContextExtractor extracts the fields to log from the context
+type ContextExtractor func(ctx context.Context) Fields
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = []ContextExtractor{fieldsExtractor, traceExtractor}
+)
+
+// RegisterContextExtractor adds the extractor which is used to get the fields
+// from the context passed by Ctx or WithContext
+func RegisterContextExtractor(extractor ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, extractor)
+}
+
+// ContextValueExtractor returns the extractor which logs the value of key in
+// context as field, eg: request id set by the http middleware
+func ContextValueExtractor(key interface{}, field string) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		v := ctx.Value(key)
+		if v == nil {
+			return nil
+		}
+		return Fields{field: v}
+	}
+}
+
+// ContextWithFields returns a copy of ctx with the fields to be logged by
+// Ctx(ctx) later, eg: request_id, user_id and tenant
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	data := make(Fields, len(fields))
+	if parent, ok := ctx.Value(keyFields).(Fields); ok {
+		for k, v := range parent {
+			data[k] = v
+		}
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+	return context.WithValue(ctx, keyFields, data)
+}
+
+func fieldsExtractor(ctx context.Context) Fields {
+	fields, _ := ctx.Value(keyFields).(Fields)
+	return fields
+}
+
+// Ctx creates an entry with the context, the fields extracted from the
+// context are logged with the entry, see NewTraceContext for the contexts
+// carrying no span
+func Ctx(ctx context.Context) *Entry {
+	entry := newEntry()
+	defer releaseEntry(entry)
+	return entry.WithContext(ctx)
+}
+
+// contextFields returns the fields extracted from the context
+func contextFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	var fields Fields
+	for _, extractor := range extractors {
+		for k, v := range extractor(ctx) {
+			if fields == nil {
+				fields = make(Fields)
+			}
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// GetFields returns the fields logged with the entry, including the fields
+// extracted from the entry context, the sensitive values are redacted
+func GetFields(entry *logrus.Entry) Fields {
+	return Fields(getData(entry))
+}
+
+// getData returns the entry data with the fields extracted from the entry
+// context, the entry data takes precedence, the sensitive values are redacted
+func getData(entry *logrus.Entry) logrus.Fields {
+	data := entry.Data
+	if fields := contextFields(entry.Context); len(fields) > 0 {
+		data = make(logrus.Fields, len(fields)+len(entry.Data))
+		for k, v := range fields {
+			data[k] = v
+		}
+		for k, v := range entry.Data {
+			data[k] = v
+		}
+	}
+	return log.EntryRedactor(entry).RedactFields(log.FilterFields(entry, data))
+}
+
+// getMessage returns the entry message with the sensitive texts redacted
+func getMessage(entry *logrus.Entry) string {
+	return log.EntryRedactor(entry).RedactString(entry.Message)
+}
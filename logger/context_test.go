@@ -0,0 +1,41 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/logger"
+)
+
+type userIDKey struct{}
+
+func TestCtx(t *testing.T) {
+	assert := assert.New(t)
+	b := &bytes.Buffer{}
+	logger.LogAccess = logrus.New()
+	logger.LogAccess.Out = b
+	logger.LogAccess.Formatter = logger.NewLogFileFormatter("tgo")
+	logger.RegisterContextExtractor(logger.ContextValueExtractor(userIDKey{}, "user_id"))
+
+	ctx := logger.ContextWithFields(context.Background(), logger.Fields{"request_id": "abc"})
+	ctx = context.WithValue(ctx, userIDKey{}, 42)
+	logger.Ctx(ctx).WithField("key", "value").Info("foo")
+	assert.Regexp(`^\S+ \[info\] \[\S*context_test\.go:\d+\] foo key=value request_id=abc user_id=42\n$`, b.String())
+
+	// the entry fields take precedence
+	b.Reset()
+	logger.WithField("request_id", "def").WithContext(ctx).Info("foo")
+	assert.Contains(b.String(), "request_id=def")
+
+	b.Reset()
+	logger.LogAccess.Formatter = logger.NewLogstashFormatter(logrus.Fields{"app_id": "tgo"})
+	logger.Ctx(ctx).Info("foo")
+	var data map[string]interface{}
+	assert.NoError(json.Unmarshal(b.Bytes(), &data))
+	assert.Equal("tgo", data["app_id"])
+	assert.Regexp(`^\[\S*context_test\.go:\d+\] foo request_id=abc user_id=42$`, data["message"])
+}
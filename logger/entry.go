@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -13,6 +14,12 @@ type Fields logrus.Fields
 type Entry struct {
 	// Contains all the fields set by the user.
 	Data Fields
+
+	// Contains the context set by the user.
+	ctx context.Context
+
+	// The logger logging the entry, nil is the default logger.
+	logger *Logger
 }
 
 var entryPool sync.Pool
@@ -31,7 +38,32 @@ func (entry *Entry) WithFields(fields Fields) *Entry {
 	for k, v := range fields {
 		data[k] = v
 	}
-	return &Entry{Data: data}
+	return &Entry{Data: data, ctx: entry.ctx, logger: entry.logger}
+}
+
+// WithContext add a context to the Entry, the fields extracted from the
+// context are logged with the entry.
+func (entry *Entry) WithContext(ctx context.Context) *Entry {
+	data := make(Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	return &Entry{Data: data, ctx: ctx, logger: entry.logger}
+}
+
+// getLogger returns the logger logging the entry
+func (entry *Entry) getLogger() *Logger {
+	if entry.logger == nil {
+		return std
+	}
+	return entry.logger
+}
+
+// newLogrusEntry creates the logrus entry of logger with the fields and context
+func (entry *Entry) newLogrusEntry(logger *logrus.Logger) *logrus.Entry {
+	logrusEntry := logger.WithFields(logrus.Fields(entry.Data))
+	logrusEntry.Context = entry.ctx
+	return logrusEntry
 }
 
 func newEntry() *Entry {
@@ -47,92 +79,102 @@ func newEntry() *Entry {
 
 func releaseEntry(entry *Entry) {
 	entry.Data = map[string]interface{}{}
+	entry.ctx = nil
+	entry.logger = nil
 	entryPool.Put(entry)
 }
 
 // Debug debug
 func (entry *Entry) Debug(args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Debug(args...)
+	l := entry.getLogger()
+	l.log(entry, logrus.DebugLevel, l.skip(), args...)
 }
 
 // Debugf debug with format
 func (entry *Entry) Debugf(format string, args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Debugf(format, args...)
+	l := entry.getLogger()
+	l.logf(entry, logrus.DebugLevel, l.skip(), format, args...)
 }
 
 // Info info
 func (entry *Entry) Info(args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Info(args...)
+	l := entry.getLogger()
+	l.log(entry, logrus.InfoLevel, l.skip(), args...)
 }
 
 // Infof info with format
 func (entry *Entry) Infof(format string, args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Infof(format, args...)
+	l := entry.getLogger()
+	l.logf(entry, logrus.InfoLevel, l.skip(), format, args...)
 }
 
 // Warn warn
 func (entry *Entry) Warn(args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Warn(args...)
+	l := entry.getLogger()
+	l.log(entry, logrus.WarnLevel, l.skip(), args...)
 }
 
 // Warnf warn with format
 func (entry *Entry) Warnf(format string, args ...interface{}) {
-	logrusEntry := LogAccess.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Warnf(format, args...)
+	l := entry.getLogger()
+	l.logf(entry, logrus.WarnLevel, l.skip(), format, args...)
 }
 
 // Error error
 func (entry *Entry) Error(args ...interface{}) {
-	logrusEntry := LogError.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Error(args...)
+	l := entry.getLogger()
+	l.log(entry, logrus.ErrorLevel, l.skip(), args...)
 }
 
 // Errorf error with format
 func (entry *Entry) Errorf(format string, args ...interface{}) {
-	logrusEntry := LogError.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Errorf(format, args...)
+	l := entry.getLogger()
+	l.logf(entry, logrus.ErrorLevel, l.skip(), format, args...)
 }
 
 // Fatal fatal
 func (entry *Entry) Fatal(args ...interface{}) {
-	logrusEntry := LogError.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Fatal(args...)
+	l := entry.getLogger()
+	l.log(entry, logrus.FatalLevel, l.skip(), args...)
 }
 
 // Fatalf fatal with formatter
 func (entry *Entry) Fatalf(format string, args ...interface{}) {
-	logrusEntry := LogError.WithFields(logrus.Fields(entry.Data))
-	SetCallFrame(logrusEntry, CallerSkip)
-	logrusEntry.Fatalf(format, args...)
+	l := entry.getLogger()
+	l.logf(entry, logrus.FatalLevel, l.skip(), format, args...)
 }
 
 // WithField adds a field to the log entry, note that it doesn't log until you
 // call Debug, Info, Warn, Error, Fatal or Panic. It only creates a log entry.
 // If you want multiple fields, use `WithFields`.
 func WithField(key string, value interface{}) *Entry {
-	entry := newEntry()
-	defer releaseEntry(entry)
-	return entry.WithField(key, value)
+	return std.WithField(key, value)
 }
 
 // WithFields adds a struct of fields to the log entry. All it does is call
 // `WithField` for each `Field`.
 func WithFields(fields Fields) *Entry {
+	return std.WithFields(fields)
+}
+
+// WithField adds a field to the entry of the logger, see WithField.
+func (l *Logger) WithField(key string, value interface{}) *Entry {
+	entry := newEntry()
+	entry.logger = l
+	defer releaseEntry(entry)
+	return entry.WithField(key, value)
+}
+
+// WithFields adds a struct of fields to the entry of the logger, see
+// WithFields.
+func (l *Logger) WithFields(fields Fields) *Entry {
 	entry := newEntry()
+	entry.logger = l
 	defer releaseEntry(entry)
 	return entry.WithFields(fields)
 }
+
+// WithContext adds a context to the entry of the logger, see WithContext.
+func (l *Logger) WithContext(ctx context.Context) *Entry {
+	return &Entry{Data: make(Fields), ctx: ctx, logger: l}
+}
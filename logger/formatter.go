@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	logrusagent "github.com/tengattack/logrus-agent-hook"
+	"github.com/tengattack/tgo/log"
 )
 
 // LogFileFormatter defines the format for log file
@@ -20,6 +22,17 @@ type LogFileFormatter struct {
 	MinimumCallerDepth int
 }
 
+// JSONFormatter defines the line-delimited JSON format
+type JSONFormatter struct {
+	TimestampFormat string
+}
+
+// LogfmtFormatter defines the logfmt format
+type LogfmtFormatter struct {
+	TimestampFormat string
+	DisableSorting  bool
+}
+
 // LogstashFormatter defines the format for Logstash
 type LogstashFormatter struct {
 	logrusagent.LogAgentFormatter
@@ -44,10 +57,49 @@ var (
 	logstashFields = logrus.Fields{"@version": "1"}
 )
 
+var formattersOnce sync.Once
+
+// setFormatters registers the formats of this package to log once, and makes
+// the formatters of log use the caller and fields of the entries set by this
+// package, the formats can be replaced by log.RegisterFormatter afterwards
+func setFormatters() {
+	formattersOnce.Do(registerFormatters)
+}
+
+func registerFormatters() {
+	newLogFileFormatter := func() logrus.Formatter {
+		return newLogFileFormatter()
+	}
+	log.RegisterFormatter(log.FormatString, newLogFileFormatter)
+	log.RegisterFormatter(log.FormatText, newLogFileFormatter)
+	log.RegisterFormatter(log.FormatJSON, func() logrus.Formatter {
+		return NewJSONFormatter()
+	})
+	log.RegisterFormatter(log.FormatLogfmt, func() logrus.Formatter {
+		return NewLogfmtFormatter()
+	})
+	log.RegisterFormatter(FormatConsole, func() logrus.Formatter {
+		return NewConsoleFormatter()
+	})
+	log.EntryCaller = func(entry *logrus.Entry) (string, int, bool) {
+		if caller := getCaller(entry); caller != nil {
+			return caller.File, caller.Line, true
+		}
+		return "", 0, false
+	}
+	log.EntryFields = getData
+}
+
 // NewLogFileFormatter return the log format for log file
 // eg: 2019-01-31T04:48:20 [info] [controllers/aibf/character.go:99] foo key=value
+// the stack captured follows as the indented lines, projectName is unused as
+// the caller files are relative to the project of the logger, see InitLog
+// and New
 func NewLogFileFormatter(projectName string) *LogFileFormatter {
-	currentProjectName = projectName
+	return newLogFileFormatter()
+}
+
+func newLogFileFormatter() *LogFileFormatter {
 	return &LogFileFormatter{
 		TextFormatter: logrus.TextFormatter{
 			TimestampFormat: "2006-01-02T15:04:05",
@@ -61,7 +113,7 @@ func NewLogFileFormatter(projectName string) *LogFileFormatter {
 // the original file log format is defined here: github.com/sirupsen/logrus/text_formatter.TextFormatter{}.Format()
 func (f *LogFileFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	data := make(Fields)
-	for k, v := range entry.Data {
+	for k, v := range getData(entry) {
 		data[k] = v
 	}
 
@@ -91,30 +143,31 @@ func (f *LogFileFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	}
 	b.WriteString(fmt.Sprintf("%s [%s]", entry.Time.Format(timestampFormat), entry.Level.String()))
 
-	if entry.Context != nil {
-		caller, _ := entry.Context.Value(keyCaller).(*runtime.Frame)
-		if caller != nil {
-			b.WriteString(fmt.Sprintf(" [%s:%d]", caller.File, caller.Line))
-		}
+	if caller := getCaller(entry); caller != nil {
+		b.WriteString(fmt.Sprintf(" [%s:%d]", caller.File, caller.Line))
 	}
 
-	if "" != entry.Message {
-		b.WriteString(" " + entry.Message)
+	if message := getMessage(entry); "" != message {
+		b.WriteString(" " + message)
 	}
 	for _, key := range keys {
 		value := data[key]
 		appendKeyValue(b, key, value, f.QuoteEmptyFields)
 	}
+	appendStack(b, entry)
 
 	b.WriteByte('\n')
 	return b.Bytes(), nil
 }
 
-// NewLogstashFormatter return the log format for Logstash
+// NewLogstashFormatter return the log format for Logstash,
+// the trace fields are top-level fields like the agent fields, and the
+// stack captured is the stack_trace field
 //
 //	eg: {"@timestamp":"2019-01-31T04:48:20.259Z","@version":"1",\
 //	  "app_id":"missevan-go","host":"DESKTOP-Q2ANV74","instance_id":"DESKTOP-Q2ANV74",\
-//	  "level":"INFO","message":"[controllers/aibf/character.go:99] foo key=value"}
+//	  "level":"INFO","message":"[controllers/aibf/character.go:99] foo key=value",\
+//	  "trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","trace_flags":"01"}
 func NewLogstashFormatter(fields logrus.Fields) *LogstashFormatter {
 	for k, v := range logstashFields {
 		if _, ok := fields[k]; !ok {
@@ -143,7 +196,7 @@ func (f *LogstashFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	data := make(logrus.Fields, len(entry.Data)+4)
 	extras := make(logrus.Fields)
 	for k, v := range entry.Data {
-		if _, ok := f.Fields[k]; ok || k == f.FieldKeyCategory {
+		if _, ok := f.Fields[k]; ok || k == f.FieldKeyCategory || isTraceField(k) {
 			switch v := v.(type) {
 			case error:
 				data[k] = v.Error()
@@ -168,11 +221,8 @@ func (f *LogstashFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	data[f.FieldKeyLevel] = getLevelString(entry.Level)
 
 	var message string
-	if entry.Context != nil {
-		caller, _ := entry.Context.Value(keyCaller).(*runtime.Frame)
-		if caller != nil {
-			message = fmt.Sprintf("[%s:%d]", caller.File, caller.Line)
-		}
+	if caller := getCaller(entry); caller != nil {
+		message = fmt.Sprintf("[%s:%d]", caller.File, caller.Line)
 	}
 	if "" != entry.Message {
 		message += " " + entry.Message
@@ -196,6 +246,9 @@ func (f *LogstashFormatter) Format(e *logrus.Entry) ([]byte, error) {
 		message += " " + b.String()
 	}
 	data[f.FieldKeyMsg] = message
+	if stack := getStack(entry); stack != nil {
+		data[FieldKeyStackTrace] = strings.Join(stackLines(stack), "\n")
+	}
 
 	serialized, err := json.Marshal(data)
 	if err != nil {
@@ -205,6 +258,120 @@ func (f *LogstashFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	return dataBytes, nil
 }
 
+// NewJSONFormatter return the line-delimited JSON format
+// eg: {"caller":"controllers/aibf/character.go:99","key":"value","level":"info","msg":"foo","time":"2019-01-31T04:48:20"}
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{
+		TimestampFormat: "2006-01-02T15:04:05",
+	}
+}
+
+// Format renders a single log entry as a JSON object
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entryData := getData(entry)
+	data := make(logrus.Fields, len(entryData)+4)
+	for k, v := range entryData {
+		switch k {
+		case "time", "level", "caller", "msg":
+			// prefix the fields clashing with the default keys
+			k = "fields." + k
+		}
+		switch v := v.(type) {
+		case error:
+			data[k] = v.Error()
+		default:
+			data[k] = v
+		}
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339
+	}
+	data["time"] = entry.Time.Format(timestampFormat)
+	data["level"] = entry.Level.String()
+	if caller := getCaller(entry); caller != nil {
+		data["caller"] = fmt.Sprintf("%s:%d", caller.File, caller.Line)
+	}
+	data["msg"] = getMessage(entry)
+	if stack := getStack(entry); stack != nil {
+		data[FieldKeyStackTrace] = strings.Join(stackLines(stack), "\n")
+	}
+
+	var b *bytes.Buffer
+	if entry.Buffer != nil {
+		b = entry.Buffer
+	} else {
+		b = &bytes.Buffer{}
+	}
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return nil, fmt.Errorf("Failed to marshal fields to JSON, %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// NewLogfmtFormatter return the logfmt format
+// eg: time=2019-01-31T04:48:20 level=info caller=controllers/aibf/character.go:99 msg=foo key=value
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{
+		TimestampFormat: "2006-01-02T15:04:05",
+	}
+}
+
+// Format renders a single log entry as a logfmt line
+func (f *LogfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := getData(entry)
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	if !f.DisableSorting {
+		sort.Strings(keys)
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339
+	}
+
+	var b *bytes.Buffer
+	if entry.Buffer != nil {
+		b = entry.Buffer
+	} else {
+		b = &bytes.Buffer{}
+	}
+	log.AppendLogfmt(b, "time", entry.Time.Format(timestampFormat))
+	log.AppendLogfmt(b, "level", entry.Level.String())
+	if caller := getCaller(entry); caller != nil {
+		log.AppendLogfmt(b, "caller", fmt.Sprintf("%s:%d", caller.File, caller.Line))
+	}
+	log.AppendLogfmt(b, "msg", getMessage(entry))
+	for _, k := range keys {
+		log.AppendLogfmt(b, k, data[k])
+	}
+	if stack := getStack(entry); len(stack) > 0 {
+		log.AppendLogfmt(b, FieldKeyStackTrace, strings.Join(stackLines(stack), "\n"))
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// GetCallFrame returns the caller frame set by SetCallFrame
+func GetCallFrame(entry *logrus.Entry) *runtime.Frame {
+	return getCaller(entry)
+}
+
+// getCaller returns the caller frame set by SetCallFrame
+func getCaller(entry *logrus.Entry) *runtime.Frame {
+	if entry.Context == nil {
+		return nil
+	}
+	caller, _ := entry.Context.Value(keyCaller).(*runtime.Frame)
+	return caller
+}
+
 // appendKeyValue append value with key to data that to be appended to log file
 func appendKeyValue(b *bytes.Buffer, key string, value interface{}, QuoteEmptyFields bool) {
 	if b.Len() > 0 {
@@ -271,14 +438,14 @@ func getLevelString(level logrus.Level) string {
 func copyEntry(e *logrus.Entry, fields logrus.Fields) *logrus.Entry {
 	ne := logstashEntryPool.Get().(*logrus.Entry)
 	ne.Context = e.Context
-	ne.Message = e.Message
+	ne.Message = getMessage(e)
 	ne.Level = e.Level
 	ne.Time = e.Time
 	ne.Data = logrus.Fields{}
 	for k, v := range fields {
 		ne.Data[k] = v
 	}
-	for k, v := range e.Data {
+	for k, v := range getData(e) {
 		ne.Data[k] = v
 	}
 	return ne
@@ -0,0 +1,127 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+func newTestEntry() *logrus.Entry {
+	entry := logrus.NewEntry(logrus.New())
+	entry.Time = time.Date(2019, 1, 31, 4, 48, 20, 0, time.UTC)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "foo"
+	logger.SetCallFrame(entry, 0)
+	return entry
+}
+
+func TestJSONFormatter(t *testing.T) {
+	assert := assert.New(t)
+	entry := newTestEntry()
+	entry.Data = logrus.Fields{"key": "value", "msg": "clash", "err": errors.New("bar")}
+
+	b, err := logger.NewJSONFormatter().Format(entry)
+	assert.NoError(err)
+	var data map[string]interface{}
+	assert.NoError(json.Unmarshal(b, &data))
+	assert.Equal("foo", data["msg"])
+	assert.Equal("clash", data["fields.msg"])
+	assert.Equal("bar", data["err"])
+	assert.Equal("info", data["level"])
+	assert.Equal("2019-01-31T04:48:20", data["time"])
+	assert.Regexp(`formatter_test\.go:\d+$`, data["caller"])
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	assert := assert.New(t)
+	entry := newTestEntry()
+	entry.Message = "foo \"bar\"\n"
+	entry.Data = logrus.Fields{"a b": "x=y", "empty": "", "null": "null", "n": 1}
+
+	b, err := logger.NewLogfmtFormatter().Format(entry)
+	assert.NoError(err)
+	assert.Regexp(`^time=2019-01-31T04:48:20 level=info caller=\S+formatter_test\.go:\d+ `+
+		`msg="foo \\"bar\\"\\n" a_b="x=y" empty= n=1 null="null"\n$`, string(b))
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	assert := assert.New(t)
+	entry := newTestEntry()
+	entry.Data = logrus.Fields{"key": "value"}
+	entry.Logger.Out = &bytes.Buffer{}
+
+	// not a terminal
+	f := logger.NewConsoleFormatter()
+	b, err := f.Format(entry)
+	assert.NoError(err)
+	plain, err := f.LogFileFormatter.Format(entry)
+	assert.NoError(err)
+	assert.Equal(string(plain), string(b))
+
+	f.ForceColors = true
+	b, err = f.Format(entry)
+	assert.NoError(err)
+	assert.Contains(string(b), "\x1b[36mINFO \x1b[0m")
+	assert.Contains(string(b), "\x1b[36mkey\x1b[0m=value")
+
+	// the empty NO_COLOR is ignored
+	t.Setenv("NO_COLOR", "")
+	b, err = f.Format(entry)
+	assert.NoError(err)
+	assert.Contains(string(b), "\x1b[36mINFO \x1b[0m")
+
+	t.Setenv("NO_COLOR", "1")
+	b, err = f.Format(entry)
+	assert.NoError(err)
+	assert.Equal(string(plain), string(b))
+}
+
+func TestRedact(t *testing.T) {
+	assert := assert.New(t)
+	r, err := log.NewRedactor(log.RedactConfig{
+		Fields:   []string{"password"},
+		Patterns: []string{`token=\w+`},
+	})
+	assert.NoError(err)
+	log.SetRedactor(r)
+	defer log.SetRedactor(nil)
+
+	entry := newTestEntry()
+	entry.Message = "login token=abc"
+	entry.Data = logrus.Fields{"password": "secret", "user": "foo"}
+
+	b, err := logger.NewLogFileFormatter("tgo").Format(entry)
+	assert.NoError(err)
+	assert.Regexp(` login \*{6} password="\*{6}" user=foo\n$`, string(b))
+
+	b, err = logger.NewLogstashFormatter(logrus.Fields{"app_id": "tgo"}).Format(entry)
+	assert.NoError(err)
+	var data map[string]interface{}
+	assert.NoError(json.Unmarshal(b, &data))
+	assert.Regexp(` login \*{6} password="\*{6}" user=foo$`, data["message"])
+	assert.Equal("secret", entry.Data["password"])
+}
+
+func TestLogFileFormatterProject(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(logger.InitLog("logger", &log.Config{
+		Format:      "string",
+		AccessLog:   "",
+		AccessLevel: "info",
+		ErrorLog:    "",
+		ErrorLevel:  "error",
+	}))
+
+	// the formatter keeps the project of InitLog
+	f := logger.NewLogFileFormatter("tgo")
+	b, err := f.Format(newTestEntry())
+	assert.NoError(err)
+	assert.Regexp(` \[formatter_test\.go:\d+\] foo\n$`, string(b))
+}
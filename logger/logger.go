@@ -3,12 +3,13 @@ package logger
 import (
 	"context"
 	"fmt"
-	"net/url"
+	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
-	logrusagent "github.com/tengattack/logrus-agent-hook"
 	"github.com/tengattack/tgo/log"
 )
 
@@ -16,6 +17,8 @@ type contextKey int
 
 const (
 	keyCaller contextKey = iota
+	keyFields
+	keyStack
 )
 
 var (
@@ -26,139 +29,337 @@ var (
 
 	// CallerSkip .
 	CallerSkip = 1
+
+	// ShutdownTimeout is the time to wait for the queued logs to be sent
+	// before exiting by Fatal
+	ShutdownTimeout = 5 * time.Second
+)
+
+var (
+	currentProjectName string
+	exitHandlerOnce    sync.Once
+
+	// std is the default logger used by the package functions
+	std = &Logger{global: true}
 )
 
-var currentProjectName string
+// Logger logs to its own access and error streams, the caller files are
+// relative to its project path.
+// The default logger follows LogAccess, LogError, CallerSkip and the project
+// name of InitLog.
+type Logger struct {
+	access      *logrus.Logger
+	errorLog    *logrus.Logger
+	projectName string
+	// callerSkip is the additional frames to skip
+	callerSkip int
+	global     bool
+}
 
 // InitLog inits the logger in this package
 func InitLog(projectName string, logConf *log.Config) error {
+	setFormatters()
+	setAgentFormatter()
+	currentProjectName = projectName
 	err := log.InitLog(logConf)
 	if err != nil {
 		return err
 	}
-	currentProjectName = projectName
 	LogAccess = log.LogAccess
 	LogError = log.LogError
+	exitHandlerOnce.Do(func() {
+		logrus.RegisterExitHandler(func() {
+			// the package loggers are replaced, eg: by loggertest, which
+			// does not exit on Fatal
+			if LogAccess != log.LogAccess || LogError != log.LogError {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+			defer cancel()
+			if err := Shutdown(ctx); err != nil {
+				fmt.Fprintln(os.Stderr, "logger shutdown error:", err)
+			}
+		})
+	})
 
-	conf := log.GetLogConfig()
-	logFileFormatter := NewLogFileFormatter(conf.Agent.AppID)
-	if logConf.AccessLog != "" {
-		LogAccess.SetFormatter(logFileFormatter)
-	}
-	if logConf.ErrorLog != "" {
-		LogError.SetFormatter(logFileFormatter)
-	}
-
-	// configure logstash
-	LogAccess.ReplaceHooks(make(logrus.LevelHooks))
-	LogError.ReplaceHooks(make(logrus.LevelHooks))
-	if conf != nil && conf.Agent.Enabled {
-		_, err := url.Parse(conf.Agent.DSN)
-		if err != nil {
-			return fmt.Errorf("parse dsn error: %v", err)
-		}
-
-		var opt logrusagent.Options
-		opt.ChannelSize = conf.Agent.ChannelSize
-
-		fields := logrus.Fields{
-			"app_id":      conf.Agent.AppID,
-			"host":        conf.Agent.Host,
-			"instance_id": conf.Agent.InstanceID,
-		}
-		if conf.Agent.Category != "" {
-			fields["category"] = conf.Agent.Category
-		}
-
-		agentFormatter := NewLogstashFormatter(fields)
-		hook, _ := logrusagent.New(conf.Agent.DSN, agentFormatter, opt)
-		LogAccess.Hooks.Add(hook)
-		LogError.Hooks.Add(hook)
-	}
 	return nil
 }
 
-// getRelativePath return the relative path of file in current project
-func getRelativePath(filePath string) string {
-	items := strings.SplitN(filePath, "/"+currentProjectName+"/", 2)
+// setAgentFormatter makes the agent hooks installed by log use the logstash
+// format
+func setAgentFormatter() {
+	log.AgentFormatter = func(fields logrus.Fields) logrus.Formatter {
+		return NewLogstashFormatter(fields)
+	}
+}
+
+// Shutdown flushes the logs queued for the agent until ctx is done and closes
+// the log files, the returned error reports the logs dropped
+func Shutdown(ctx context.Context) error {
+	return log.Close(ctx)
+}
+
+// New creates the logger with its own streams built by the config, the
+// caller files are relative to the project path of projectName.
+// The logger should be closed by Close, the loggers not closed are flushed
+// by Shutdown.
+func New(projectName string, logConf *log.Config) (*Logger, error) {
+	setFormatters()
+	setAgentFormatter()
+	access, errorLog, err := log.NewLoggers(logConf)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{
+		access:      access,
+		errorLog:    errorLog,
+		projectName: projectName,
+	}, nil
+}
+
+// Default returns the default logger used by the package functions
+func Default() *Logger {
+	return std
+}
+
+// WithCallerSkip returns a copy of the logger skipping additional frames to
+// report the caller, eg: 1 for the logging helpers
+func (l *Logger) WithCallerSkip(skip int) *Logger {
+	nl := *l
+	nl.callerSkip += skip
+	return &nl
+}
+
+// AccessLogger returns the access stream logger
+func (l *Logger) AccessLogger() *logrus.Logger {
+	if l.global {
+		return LogAccess
+	}
+	return l.access
+}
+
+// ErrorLogger returns the error stream logger
+func (l *Logger) ErrorLogger() *logrus.Logger {
+	if l.global {
+		return LogError
+	}
+	return l.errorLog
+}
+
+// Close flushes the logs queued for the agent until ctx is done and closes
+// the outputs of the logger, closing the default logger is Shutdown
+func (l *Logger) Close(ctx context.Context) error {
+	if l.global {
+		return Shutdown(ctx)
+	}
+	return log.CloseLoggers(ctx, l.access, l.errorLog)
+}
+
+// skip returns the frames to skip from the logging method to its caller
+func (l *Logger) skip() int {
+	if l.global {
+		return CallerSkip + l.callerSkip
+	}
+	return 1 + l.callerSkip
+}
+
+// project returns the project name of the caller files
+func (l *Logger) project() string {
+	if l.global {
+		return currentProjectName
+	}
+	return l.projectName
+}
+
+// newLogrusEntry creates the logrus entry of the level stream with the
+// fields and context of entry, and the caller frame skip frames above the
+// caller of newLogrusEntry. It returns false if the level is not enabled.
+func (l *Logger) newLogrusEntry(entry *Entry, level logrus.Level, skip int) (*logrus.Entry, bool) {
+	logger := l.AccessLogger()
+	if level <= logrus.ErrorLevel {
+		logger = l.ErrorLogger()
+	}
+	var logrusEntry *logrus.Entry
+	if entry != nil {
+		logrusEntry = entry.newLogrusEntry(logger)
+	} else {
+		logrusEntry = logrus.NewEntry(logger)
+	}
+	_, file, line, _ := runtime.Caller(skip + 2)
+	setProjectCallFrame(logrusEntry, l.project(), file, line)
+	// fatal is always logged
+	if level != logrus.FatalLevel && !levelEnabled(logrusEntry, level) {
+		return nil, false
+	}
+	if log.StackEnabled(logger, level) {
+		setStack(logrusEntry, l.project(), skip+2, log.StackDepth(logger))
+	}
+	return logrusEntry, true
+}
+
+// log logs the args at level, skip is the frames to skip from the caller of
+// log to the caller reported
+func (l *Logger) log(entry *Entry, level logrus.Level, skip int, args ...interface{}) {
+	logrusEntry, ok := l.newLogrusEntry(entry, level, skip)
+	if !ok {
+		return
+	}
+	if level == logrus.FatalLevel {
+		logrusEntry.Fatal(args...)
+		return
+	}
+	logrusEntry.Log(level, args...)
+}
+
+// logf logs the args with format at level like log
+func (l *Logger) logf(entry *Entry, level logrus.Level, skip int, format string, args ...interface{}) {
+	logrusEntry, ok := l.newLogrusEntry(entry, level, skip)
+	if !ok {
+		return
+	}
+	if level == logrus.FatalLevel {
+		logrusEntry.Fatalf(format, args...)
+		return
+	}
+	logrusEntry.Logf(level, format, args...)
+}
+
+// getRelativePath return the relative path of file in the project
+func getRelativePath(projectName, filePath string) string {
+	items := strings.SplitN(filePath, "/"+projectName+"/", 2)
 	return items[len(items)-1]
 }
 
 // SetCallFrame .
 func SetCallFrame(entry *logrus.Entry, skip int) {
 	_, file, line, _ := runtime.Caller(skip + 1)
-	entry.Context = context.WithValue(context.Background(), keyCaller, &runtime.Frame{
-		File: getRelativePath(file),
+	setCallFrame(entry, file, line)
+}
+
+// setCallFrame stores the caller frame in entry context
+func setCallFrame(entry *logrus.Entry, file string, line int) {
+	setProjectCallFrame(entry, currentProjectName, file, line)
+}
+
+// setProjectCallFrame stores the caller frame relative to the project path
+// in entry context
+func setProjectCallFrame(entry *logrus.Entry, projectName, file string, line int) {
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry.Context = context.WithValue(ctx, keyCaller, &runtime.Frame{
+		File: getRelativePath(projectName, file),
 		Line: line,
 	})
 }
 
+// levelEnabled checks whether the level is enabled for the caller of entry
+// by the logger level and the vmodule rules
+func levelEnabled(entry *logrus.Entry, level logrus.Level) bool {
+	var file string
+	if caller := getCaller(entry); caller != nil {
+		file = caller.File
+	}
+	return log.LevelEnabled(entry.Logger, level, file)
+}
+
 // Debug log as debug level
 func Debug(args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Debug(args...)
+	std.log(nil, logrus.DebugLevel, CallerSkip, args...)
 }
 
 // Debugf log as debug level with format
 func Debugf(format string, args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Debugf(format, args...)
+	std.logf(nil, logrus.DebugLevel, CallerSkip, format, args...)
 }
 
 // Info log as info level
 func Info(args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Info(args...)
+	std.log(nil, logrus.InfoLevel, CallerSkip, args...)
 }
 
 // Infof log as info level with format
 func Infof(format string, args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Infof(format, args...)
+	std.logf(nil, logrus.InfoLevel, CallerSkip, format, args...)
 }
 
 // Warn log as warn level
 func Warn(args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Warn(args...)
+	std.log(nil, logrus.WarnLevel, CallerSkip, args...)
 }
 
 // Warnf log as warn level with format
 func Warnf(format string, args ...interface{}) {
-	entry := logrus.NewEntry(LogAccess)
-	SetCallFrame(entry, CallerSkip)
-	entry.Warnf(format, args...)
+	std.logf(nil, logrus.WarnLevel, CallerSkip, format, args...)
 }
 
 // Error log as error level
 func Error(args ...interface{}) {
-	entry := logrus.NewEntry(LogError)
-	SetCallFrame(entry, CallerSkip)
-	entry.Error(args...)
+	std.log(nil, logrus.ErrorLevel, CallerSkip, args...)
 }
 
 // Errorf log as error level with format
 func Errorf(format string, args ...interface{}) {
-	entry := logrus.NewEntry(LogError)
-	SetCallFrame(entry, CallerSkip)
-	entry.Errorf(format, args...)
+	std.logf(nil, logrus.ErrorLevel, CallerSkip, format, args...)
 }
 
 // Fatal log as fatal level and exit
 func Fatal(args ...interface{}) {
-	entry := logrus.NewEntry(LogError)
-	SetCallFrame(entry, CallerSkip)
-	entry.Fatal(args...)
+	std.log(nil, logrus.FatalLevel, CallerSkip, args...)
 }
 
 // Fatalf log as fatal level with format and exit
 func Fatalf(format string, args ...interface{}) {
-	entry := logrus.NewEntry(LogError)
-	SetCallFrame(entry, CallerSkip)
-	entry.Fatalf(format, args...)
+	std.logf(nil, logrus.FatalLevel, CallerSkip, format, args...)
+}
+
+// Debug log as debug level
+func (l *Logger) Debug(args ...interface{}) {
+	l.log(nil, logrus.DebugLevel, l.skip(), args...)
+}
+
+// Debugf log as debug level with format
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(nil, logrus.DebugLevel, l.skip(), format, args...)
+}
+
+// Info log as info level
+func (l *Logger) Info(args ...interface{}) {
+	l.log(nil, logrus.InfoLevel, l.skip(), args...)
+}
+
+// Infof log as info level with format
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(nil, logrus.InfoLevel, l.skip(), format, args...)
+}
+
+// Warn log as warn level
+func (l *Logger) Warn(args ...interface{}) {
+	l.log(nil, logrus.WarnLevel, l.skip(), args...)
+}
+
+// Warnf log as warn level with format
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(nil, logrus.WarnLevel, l.skip(), format, args...)
+}
+
+// Error log as error level
+func (l *Logger) Error(args ...interface{}) {
+	l.log(nil, logrus.ErrorLevel, l.skip(), args...)
+}
+
+// Errorf log as error level with format
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(nil, logrus.ErrorLevel, l.skip(), format, args...)
+}
+
+// Fatal log as fatal level and exit
+func (l *Logger) Fatal(args ...interface{}) {
+	l.log(nil, logrus.FatalLevel, l.skip(), args...)
+}
+
+// Fatalf log as fatal level with format and exit
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.logf(nil, logrus.FatalLevel, l.skip(), format, args...)
 }
@@ -0,0 +1,150 @@
+package logger_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+func readJSONLines(t *testing.T, path string) []map[string]interface{} {
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if line == "" {
+			continue
+		}
+		var data map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &data))
+		lines = append(lines, data)
+	}
+	return lines
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	newConf := func(name, level string) *log.Config {
+		return &log.Config{
+			Format:      "json",
+			AccessLog:   filepath.Join(dir, name+".access.log"),
+			AccessLevel: level,
+			ErrorLog:    filepath.Join(dir, name+".error.log"),
+			ErrorLevel:  "error",
+		}
+	}
+
+	a, err := logger.New("logger", newConf("a", "info"))
+	assert.NoError(err)
+	b, err := logger.New("module", newConf("b", "debug"))
+	assert.NoError(err)
+
+	a.Debug("a debug")
+	a.WithField("key", "value").Info("a info")
+	a.Errorf("a %s", "error")
+	b.Debug("b debug")
+	b.WithContext(logger.NewTraceContext(context.Background())).Warn("b warn")
+	logHelper(a.WithCallerSkip(1))
+
+	assert.NoError(a.Close(context.Background()))
+	assert.NoError(b.Close(context.Background()))
+
+	access := readJSONLines(t, filepath.Join(dir, "a.access.log"))
+	if assert.Len(access, 2) {
+		assert.Equal("a info", access[0]["msg"])
+		assert.Equal("value", access[0]["key"])
+		assert.Regexp(`^logger_test\.go:\d+$`, access[0]["caller"])
+		// the caller of the helper is reported
+		assert.Equal("helper", access[1]["msg"])
+		assert.Regexp(`^logger_test\.go:\d+$`, access[1]["caller"])
+		assert.NotEqual(access[0]["caller"], access[1]["caller"])
+	}
+	errs := readJSONLines(t, filepath.Join(dir, "a.error.log"))
+	if assert.Len(errs, 1) {
+		assert.Equal("a error", errs[0]["msg"])
+	}
+
+	access = readJSONLines(t, filepath.Join(dir, "b.access.log"))
+	if assert.Len(access, 2) {
+		assert.Equal("b debug", access[0]["msg"])
+		assert.Equal("b warn", access[1]["msg"])
+		assert.NotEmpty(access[1]["trace_id"])
+		// the project path is not found in the caller file
+		assert.Regexp(`/logger/logger_test\.go:\d+$`, access[0]["caller"])
+	}
+	assert.Empty(readJSONLines(t, filepath.Join(dir, "b.error.log")))
+
+	// the redactor and the vmodule rules of the config
+	conf := newConf("c", "info")
+	conf.Redact.Fields = []string{"token"}
+	conf.VModule = "logger_test=debug"
+	c, err := logger.New("logger", conf)
+	assert.NoError(err)
+	c.WithField("token", "secret").Debug("c debug")
+	assert.NoError(c.Close(context.Background()))
+	access = readJSONLines(t, filepath.Join(dir, "c.access.log"))
+	if assert.Len(access, 1) {
+		assert.Equal("c debug", access[0]["msg"])
+		assert.Equal(log.RedactedValue, access[0]["token"])
+	}
+	// the global redactor is not changed
+	assert.Equal("secret", log.GetRedactor().RedactFields(logrus.Fields{"token": "secret"})["token"])
+
+	// the output shared by another logger is kept open
+	d1, err := logger.New("logger", newConf("d", "info"))
+	assert.NoError(err)
+	d2, err := logger.New("logger", newConf("d", "info"))
+	assert.NoError(err)
+	assert.NoError(d1.Close(context.Background()))
+	d2.Info("d info")
+	assert.NoError(d2.Close(context.Background()))
+	access = readJSONLines(t, filepath.Join(dir, "d.access.log"))
+	if assert.Len(access, 1) {
+		assert.Equal("d info", access[0]["msg"])
+	}
+
+	// the invalid config
+	_, err = logger.New("logger", &log.Config{Format: "xml"})
+	assert.Error(err)
+}
+
+func logHelper(l *logger.Logger) {
+	l.Info("helper")
+}
+
+func TestDefault(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	assert.NoError(logger.InitLog("logger", &log.Config{
+		Format:      "json",
+		AccessLog:   path,
+		AccessLevel: "info",
+		ErrorLog:    "stderr",
+		ErrorLevel:  "error",
+	}))
+
+	logger.Info("package")
+	logger.Default().Info("default")
+	logger.WithField("key", "value").Info("entry")
+	assert.Same(logger.LogAccess, logger.Default().AccessLogger())
+
+	lines := readJSONLines(t, path)
+	if assert.Len(lines, 3) {
+		assert.Equal("package", lines[0]["msg"])
+		assert.Equal("default", lines[1]["msg"])
+		assert.Equal("entry", lines[2]["msg"])
+		assert.Equal("value", lines[2]["key"])
+		for _, line := range lines {
+			assert.Regexp(`^logger_test\.go:\d+$`, line["caller"])
+		}
+	}
+}
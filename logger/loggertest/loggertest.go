@@ -0,0 +1,224 @@
+// Package loggertest provides a recorder to capture and assert the entries
+// logged by the logger package in tests.
+package loggertest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+// Entry is a captured log entry
+type Entry struct {
+	Time    time.Time
+	Level   logrus.Level
+	Message string
+	Fields  logger.Fields
+	// Caller is the caller set by logger.SetCallFrame, eg: models/user.go:99
+	Caller string
+}
+
+// Recorder captures the entries logged to logger.LogAccess and
+// logger.LogError, it replaces the package globals so tests using it must
+// not run in parallel. Fatal does not exit while the recorder is installed,
+// the exit handlers registered by logrus.RegisterExitHandler still run
+// except the shutdown of logger.InitLog.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Option configures the Recorder
+type Option func(o *options)
+
+type options struct {
+	testLog bool
+}
+
+// WithTestLog forwards the formatted log lines to t.Log
+func WithTestLog() Option {
+	return func(o *options) {
+		o.testLog = true
+	}
+}
+
+// New installs a recorder at debug level for the test, the loggers are
+// restored when the test and its subtests complete
+func New(t testing.TB, opts ...Option) *Recorder {
+	t.Helper()
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r := &Recorder{}
+	access, errorLog := r.newLogger(), r.newLogger()
+	if o.testLog {
+		access.Out = &testWriter{t: t}
+		errorLog.Out = &testWriter{t: t}
+	}
+
+	prevAccess, prevError := logger.LogAccess, logger.LogError
+	logger.LogAccess, logger.LogError = access, errorLog
+	t.Cleanup(func() {
+		logger.LogAccess, logger.LogError = prevAccess, prevError
+	})
+	return r
+}
+
+func (r *Recorder) newLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = io.Discard
+	l.Level = logrus.DebugLevel
+	l.Formatter, _ = log.NewFormatter(log.FormatString)
+	// the recorder is used by Fatal without exiting
+	l.ExitFunc = func(int) {}
+	l.AddHook(r)
+	return l
+}
+
+// Levels returns all the levels
+func (r *Recorder) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire captures the entry
+func (r *Recorder) Fire(entry *logrus.Entry) error {
+	e := Entry{
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Message: entry.Message,
+		Fields:  logger.GetFields(entry),
+	}
+	if caller := logger.GetCallFrame(entry); caller != nil {
+		e.Caller = fmt.Sprintf("%s:%d", caller.File, caller.Line)
+	}
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+	return nil
+}
+
+// Entries returns the captured entries
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+	return entries
+}
+
+// Reset discards the captured entries
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// Find returns the entries of the level, contain the message substring and
+// have the fields with equal values
+func (r *Recorder) Find(level logrus.Level, msg string, fields logger.Fields) []Entry {
+	var entries []Entry
+	for _, e := range r.Entries() {
+		if e.match(level, msg, fields) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// AssertLogged checks there is an entry of the level, contains the message
+// substring and has the fields with equal values
+func (r *Recorder) AssertLogged(t testing.TB, level logrus.Level, msg string, fields logger.Fields) bool {
+	t.Helper()
+	if len(r.Find(level, msg, fields)) > 0 {
+		return true
+	}
+	t.Errorf("no %s entry contains %q with fields %v, captured:\n%s", level, msg, fields, r)
+	return false
+}
+
+// AssertNotLogged checks there is no entry of the level, contains the
+// message substring and has the fields with equal values
+func (r *Recorder) AssertNotLogged(t testing.TB, level logrus.Level, msg string, fields logger.Fields) bool {
+	t.Helper()
+	entries := r.Find(level, msg, fields)
+	if len(entries) == 0 {
+		return true
+	}
+	t.Errorf("unexpected %s entry contains %q with fields %v: %s", level, msg, fields, entries[0])
+	return false
+}
+
+// String returns the captured entries one per line
+func (r *Recorder) String() string {
+	var b strings.Builder
+	for _, e := range r.Entries() {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// String returns the entry like: [info] [models/user.go:99] foo key=value
+func (e Entry) String() string {
+	s := fmt.Sprintf("[%s] [%s] %s", e.Level, e.Caller, e.Message)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s += fmt.Sprintf(" %s=%v", k, e.Fields[k])
+	}
+	return s
+}
+
+func (e Entry) match(level logrus.Level, msg string, fields logger.Fields) bool {
+	if e.Level != level || !strings.Contains(e.Message, msg) {
+		return false
+	}
+	for k, want := range fields {
+		got, ok := e.Fields[k]
+		if !ok || !equal(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// equal compares the field values, errors and strings are compared by text
+func equal(got, want interface{}) bool {
+	if reflect.DeepEqual(got, want) {
+		return true
+	}
+	if s, ok := want.(string); ok {
+		switch got := got.(type) {
+		case error:
+			return got.Error() == s
+		case fmt.Stringer:
+			return got.String() == s
+		}
+	}
+	return false
+}
+
+// testWriter writes the log lines to t.Log
+type testWriter struct {
+	t testing.TB
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(string(bytes.TrimSuffix(p, []byte{'\n'})))
+	return len(p), nil
+}
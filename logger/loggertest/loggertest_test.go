@@ -0,0 +1,69 @@
+package loggertest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+	"github.com/tengattack/tgo/logger/loggertest"
+)
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	prev := logger.LogAccess
+
+	t.Run("record", func(t *testing.T) {
+		r := loggertest.New(t, loggertest.WithTestLog())
+		logger.WithField("user_id", 1).Info("user login")
+		ctx := logger.ContextWithFields(context.Background(), logger.Fields{"request_id": "abc"})
+		logger.Ctx(ctx).Debug("debug")
+		logger.WithField("err", errors.New("timeout")).Error("query failed")
+
+		entries := r.Entries()
+		assert.Len(entries, 3)
+		assert.Equal(logrus.InfoLevel, entries[0].Level)
+		assert.Regexp(`loggertest_test\.go:\d+$`, entries[0].Caller)
+		r.AssertLogged(t, logrus.InfoLevel, "login", logger.Fields{"user_id": 1})
+		r.AssertLogged(t, logrus.DebugLevel, "", logger.Fields{"request_id": "abc"})
+		r.AssertLogged(t, logrus.ErrorLevel, "query", logger.Fields{"err": "timeout"})
+		r.AssertNotLogged(t, logrus.WarnLevel, "", nil)
+		assert.Empty(r.Find(logrus.InfoLevel, "logout", nil))
+
+		r.Reset()
+		assert.Empty(r.Entries())
+	})
+
+	// restored after the test
+	assert.Equal(prev, logger.LogAccess)
+}
+
+func TestRecorderFatal(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "error.log")
+	assert.NoError(logger.InitLog("loggertest", &log.Config{
+		Format:      "string",
+		AccessLog:   "stdout",
+		AccessLevel: "info",
+		ErrorLog:    path,
+		ErrorLevel:  "error",
+	}))
+	defer logger.Shutdown(context.Background())
+
+	t.Run("fatal", func(t *testing.T) {
+		r := loggertest.New(t)
+		logger.Fatal("fatal")
+		r.AssertLogged(t, logrus.FatalLevel, "fatal", nil)
+	})
+
+	// the log files are not closed by the fatal entry
+	logger.Error("after")
+	b, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Contains(string(b), "after")
+}
@@ -0,0 +1,224 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// panic fields, the stack is logged as FieldKeyStackTrace
+const (
+	FieldKeyPanic     = "panic"
+	FieldKeyMethod    = "method"
+	FieldKeyPath      = "path"
+	FieldKeyRequestID = "request_id"
+)
+
+// RequestIDHeader is the header of the request id logged by RecoverHandler
+var RequestIDHeader = "X-Request-Id"
+
+// RecoverOption configures Recover, Go and RecoverHandler
+type RecoverOption func(o *recoverOptions)
+
+type recoverOptions struct {
+	repanic bool
+}
+
+// WithRepanic panics again with the recovered value after logging it
+func WithRepanic() RecoverOption {
+	return func(o *recoverOptions) {
+		o.repanic = true
+	}
+}
+
+func newRecoverOptions(opts []RecoverOption) recoverOptions {
+	var o recoverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Recover recovers the panic and logs it as error level with the stack, it
+// must be called directly by defer, eg: defer logger.Recover()
+func Recover(opts ...RecoverOption) {
+	if r := recover(); r != nil {
+		std.logPanic(nil, r, newRecoverOptions(opts))
+	}
+}
+
+// Go runs fn in a new goroutine, the panic in fn is logged by Recover
+func Go(fn func(), opts ...RecoverOption) {
+	std.Go(fn, opts...)
+}
+
+// RecoverHandler returns the http middleware which logs the panic in next
+// with the request method, path and request id, the status 500 is written
+// if the response is not started and the panic is not repanicked
+func RecoverHandler(next http.Handler, opts ...RecoverOption) http.Handler {
+	return std.RecoverHandler(next, opts...)
+}
+
+// Recover recovers the panic and logs it by the logger, see Recover
+func (l *Logger) Recover(opts ...RecoverOption) {
+	if r := recover(); r != nil {
+		l.logPanic(nil, r, newRecoverOptions(opts))
+	}
+}
+
+// Go runs fn in a new goroutine, the panic in fn is logged by the logger
+func (l *Logger) Go(fn func(), opts ...RecoverOption) {
+	go func() {
+		defer l.Recover(opts...)
+		fn()
+	}()
+}
+
+// RecoverHandler returns the http middleware which logs the panic in next by
+// the logger, see RecoverHandler
+func (l *Logger) RecoverHandler(next http.Handler, opts ...RecoverOption) http.Handler {
+	o := newRecoverOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					// the handler aborts the response on purpose
+					panic(v)
+				}
+				fields := Fields{
+					FieldKeyMethod: r.Method,
+					FieldKeyPath:   r.URL.Path,
+				}
+				if id := r.Header.Get(RequestIDHeader); id != "" {
+					fields[FieldKeyRequestID] = id
+				}
+				l.logPanic(l.WithFields(fields).WithContext(r.Context()), v, o)
+				if !rw.started {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// responseWriter records whether the response is started
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+// WriteHeader writes the header and starts the response
+func (w *responseWriter) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the body and starts the response
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the response if it is supported by the writer
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection if it is supported by the writer, the
+// response is started by the handler then
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.started = true
+	return h.Hijack()
+}
+
+// Push initiates the HTTP/2 server push if it is supported by the writer
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom writes the body from r and starts the response, the writer
+// copies from r directly if it supports io.ReaderFrom, eg: sendfile
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.started = true
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Unwrap returns the writer wrapped for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logPanic logs the recovered value with the stack at the frame panicking,
+// and panics again if repanic is set
+func (l *Logger) logPanic(entry *Entry, v interface{}, o recoverOptions) {
+	logrusEntry := logrus.NewEntry(l.ErrorLogger())
+	if entry != nil {
+		logrusEntry = entry.newLogrusEntry(l.ErrorLogger())
+	}
+	logrusEntry = logrusEntry.WithField(FieldKeyPanic, fmt.Sprint(v))
+	// the whole stack is logged regardless of the stack depth of the config
+	stack := panicStack()
+	storeStack(logrusEntry, l.project(), stack, len(stack))
+	file, line := panicCaller(stack)
+	setProjectCallFrame(logrusEntry, l.project(), file, line)
+	if levelEnabled(logrusEntry, logrus.ErrorLevel) {
+		logrusEntry.Error("panic: ", v)
+	}
+	if o.repanic {
+		panic(v)
+	}
+}
+
+// panicStack returns the program counters of the frames panicking, which
+// are called by runtime.gopanic
+func panicStack() []uintptr {
+	pcs := make([]uintptr, 64)
+	// skip runtime.Callers and panicStack
+	n := runtime.Callers(2, pcs)
+	for n == len(pcs) {
+		pcs = make([]uintptr, len(pcs)*2)
+		n = runtime.Callers(2, pcs)
+	}
+	for i, pc := range pcs[:n] {
+		if f := runtime.FuncForPC(pc - 1); f != nil && f.Name() == "runtime.gopanic" {
+			return pcs[i+1 : n]
+		}
+	}
+	return nil
+}
+
+// panicCaller returns the frame calling panic, or the runtime function
+// panicking eg: a nil map write
+func panicCaller(stack []uintptr) (string, int) {
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.File, frame.Line
+		}
+		if !more {
+			return "", 0
+		}
+	}
+}
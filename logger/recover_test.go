@@ -0,0 +1,153 @@
+package logger_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+func TestRecover(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "error.log")
+	l, err := logger.New("logger", &log.Config{
+		Format:      "json",
+		AccessLog:   "",
+		AccessLevel: "info",
+		ErrorLog:    path,
+		ErrorLevel:  "error",
+	})
+	assert.NoError(err)
+
+	h := l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/foo?bar=1", nil)
+	req.Header.Set(logger.RequestIDHeader, "abc")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+
+	assert.PanicsWithValue("again", func() {
+		defer l.Recover(logger.WithRepanic())
+		panic("again")
+	})
+
+	// the status written already is kept
+	h = l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("started")
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(http.StatusAccepted, rec.Code)
+
+	l.Go(func() {
+		var m map[string]int
+		m["nil"] = 1
+	})
+	assert.Eventually(func() bool {
+		return len(readJSONLines(t, path)) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(l.Close(context.Background()))
+
+	lines := readJSONLines(t, path)
+	if assert.Len(lines, 4) {
+		assert.Equal("boom", lines[0]["panic"])
+		assert.Equal("POST", lines[0]["method"])
+		assert.Equal("/foo", lines[0]["path"])
+		assert.Equal("abc", lines[0]["request_id"])
+		assert.Regexp(`^recover_test\.go:\d+$`, lines[0]["caller"])
+		assert.Regexp(`^recover_test\.go:\d+ logger_test\.TestRecover\.func1\n`, lines[0]["stack_trace"])
+
+		assert.Equal("again", lines[1]["panic"])
+		assert.NotEqual(lines[0]["caller"], lines[1]["caller"])
+
+		assert.Equal("started", lines[2]["panic"])
+
+		assert.Equal("panic: assignment to entry in nil map", lines[3]["msg"])
+		assert.Regexp(`^recover_test\.go:\d+$`, lines[3]["caller"])
+	}
+}
+
+// hijackRecorder is the recorder supporting Hijack
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	c, _ := net.Pipe()
+	return c, bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c)), nil
+}
+
+func TestRecoverHijacked(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "error.log")
+	l, err := logger.New("logger", &log.Config{
+		Format:      "json",
+		AccessLog:   "",
+		AccessLevel: "info",
+		ErrorLog:    path,
+		ErrorLevel:  "error",
+		StackDepth:  2,
+	})
+	assert.NoError(err)
+	defer l.Close(context.Background())
+
+	// nothing is written to the hijacked connection
+	h := l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := w.(http.Hijacker).Hijack()
+		assert.NoError(err)
+		defer c.Close()
+		panic("hijacked")
+	}))
+	rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(rec.hijacked)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	// the response writer without Hijack
+	h = l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.ErrorIs(err, http.ErrNotSupported)
+		_, err = w.(io.ReaderFrom).ReadFrom(strings.NewReader("body"))
+		assert.NoError(err)
+		panic("read from")
+	}))
+	plain := httptest.NewRecorder()
+	h.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(http.StatusOK, plain.Code)
+	assert.Equal("body", plain.Body.String())
+
+	// the panic stack is not limited by the stack depth
+	var recurse func(n int)
+	recurse = func(n int) {
+		if n == 0 {
+			panic("deep")
+		}
+		recurse(n - 1)
+	}
+	func() {
+		defer l.Recover()
+		recurse(100)
+	}()
+
+	lines := readJSONLines(t, path)
+	if assert.Len(lines, 3) {
+		assert.Equal("hijacked", lines[0]["panic"])
+		assert.Equal("deep", lines[2]["panic"])
+		assert.Greater(strings.Count(lines[2]["stack_trace"].(string), "\n"), 100)
+	}
+}
@@ -0,0 +1,42 @@
+package logger_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+func TestOutputs(t *testing.T) {
+	assert := assert.New(t)
+	isTerm := log.IsTerm
+	log.IsTerm = true
+	defer func() { log.IsTerm = isTerm }()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	assert.NoError(logger.InitLog("logger", &log.Config{
+		Format:      logger.FormatConsole,
+		AccessLog:   "stdout",
+		AccessLevel: "info",
+		ErrorLog:    "stderr",
+		ErrorLevel:  "error",
+		Outputs: []log.OutputConfig{
+			{Stream: log.StreamAccess, Path: path, ExcludeFields: []string{"token"}},
+		},
+	}))
+
+	ctx := logger.ContextWithFields(context.Background(), logger.Fields{"token": "secret", "user": "foo"})
+	logger.Ctx(ctx).Info("message")
+
+	b, err := os.ReadFile(path)
+	assert.NoError(err)
+	// the sink output is not a terminal
+	assert.NotContains(string(b), "\x1b[")
+	// the context fields are filtered
+	assert.Contains(string(b), "user=foo")
+	assert.NotContains(string(b), "secret")
+}
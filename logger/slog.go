@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlogHandler is a slog.Handler which logs the records to LogAccess or
+// LogError like the functions in this package, the attributes in groups are
+// logged with the dotted keys, eg: request.method=GET
+type SlogHandler struct {
+	fields Fields
+	prefix string
+}
+
+var _ slog.Handler = (*SlogHandler)(nil)
+
+// NewSlogHandler returns the slog handler
+func NewSlogHandler() *SlogHandler {
+	return &SlogHandler{}
+}
+
+// SetSlogDefault makes the slog handler of this package the default handler
+// of log/slog
+func SetSlogDefault() {
+	slog.SetDefault(slog.New(NewSlogHandler()))
+}
+
+// Enabled checks whether the level is enabled by the logger level
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	l := slogLogger(level)
+	return l != nil && l.IsLevelEnabled(slogLevel(level))
+}
+
+// Handle logs the record with the caller of record
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := slogLogger(r.Level)
+	if l == nil {
+		return nil
+	}
+	data := make(logrus.Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		data[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(Fields(data), h.prefix, a)
+		return true
+	})
+
+	entry := logrus.NewEntry(l)
+	entry.Data = data
+	entry.Time = r.Time
+	entry.Context = ctx
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		setCallFrame(entry, frame.File, frame.Line)
+	}
+	level := slogLevel(r.Level)
+	if !levelEnabled(entry, level) {
+		return nil
+	}
+	entry.Log(level, r.Message)
+	return nil
+}
+
+// WithAttrs returns a new handler with the attributes added
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make(Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addSlogAttr(fields, h.prefix, a)
+	}
+	return &SlogHandler{fields: fields, prefix: h.prefix}
+}
+
+// WithGroup returns a new handler with the group name as the key prefix
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// addSlogAttr adds the attribute to fields, group attributes are flattened
+func addSlogAttr(fields Fields, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addSlogAttr(fields, prefix, ga)
+		}
+		return
+	}
+	fields[prefix+a.Key] = a.Value.Any()
+}
+
+// slogLogger returns LogError for error level and above, otherwise LogAccess
+func slogLogger(level slog.Level) *logrus.Logger {
+	if level >= slog.LevelError {
+		return LogError
+	}
+	return LogAccess
+}
+
+// slogLevel converts the slog level to logrus level
+func slogLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	}
+	return logrus.DebugLevel
+}
@@ -0,0 +1,34 @@
+package logger_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/logger"
+)
+
+func TestSlogHandler(t *testing.T) {
+	assert := assert.New(t)
+	access, errorLog := &bytes.Buffer{}, &bytes.Buffer{}
+	logger.LogAccess = logrus.New()
+	logger.LogAccess.Out = access
+	logger.LogAccess.Formatter = logger.NewLogFileFormatter("tgo")
+	logger.LogError = logrus.New()
+	logger.LogError.Out = errorLog
+	logger.LogError.Formatter = logger.NewLogFileFormatter("tgo")
+
+	l := slog.New(logger.NewSlogHandler()).With("a", 1).WithGroup("req")
+	l.Info("foo", "method", "GET", slog.Group("user", "id", 2))
+	assert.Regexp(`^\S+ \[info\] \[\S*slog_test\.go:\d+\] foo a=1 req.method=GET req.user.id=2\n$`, access.String())
+
+	l.Debug("debug")
+	assert.NotContains(access.String(), "debug")
+
+	l.Error("bar", "err", errors.New("baz"))
+	assert.Regexp(`^\S+ \[error\] \[\S*slog_test\.go:\d+\] bar a=1 req.err=baz\n$`, errorLog.String())
+	assert.NotContains(access.String(), "bar")
+}
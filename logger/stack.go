@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKeyStackTrace is the key of the stack captured for the entry
+const FieldKeyStackTrace = "stack_trace"
+
+// GetStackTrace returns the stack captured for the entry
+func GetStackTrace(entry *logrus.Entry) []runtime.Frame {
+	return getStack(entry)
+}
+
+// getStack returns the stack captured for the entry
+func getStack(entry *logrus.Entry) []runtime.Frame {
+	if entry.Context == nil {
+		return nil
+	}
+	stack, _ := entry.Context.Value(keyStack).([]runtime.Frame)
+	return stack
+}
+
+// setStack stores at most depth frames of the stack of the error fields of
+// entry if any, otherwise the stack skip frames above the caller of
+// setStack, the file paths are relative to the project path
+func setStack(entry *logrus.Entry, projectName string, skip, depth int) {
+	pcs := errorStack(entry.Data)
+	if pcs == nil {
+		var buf [64]uintptr
+		// skip runtime.Callers and setStack
+		n := runtime.Callers(skip+2, buf[:])
+		pcs = buf[:n]
+	}
+	storeStack(entry, projectName, pcs, depth)
+}
+
+// storeStack stores at most depth frames of the program counters in the
+// entry context except the runtime ones, the file paths are relative to the
+// project path
+func storeStack(entry *logrus.Entry, projectName string, pcs []uintptr, depth int) {
+	var stack []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for len(stack) < depth {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			frame.File = getRelativePath(projectName, frame.File)
+			stack = append(stack, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	if len(stack) == 0 {
+		return
+	}
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry.Context = context.WithValue(ctx, keyStack, stack)
+}
+
+// errorStack returns the stack of the error fields, the error field is
+// preferred, and the stack of the innermost error carrying one in the chain
+// is used
+func errorStack(data logrus.Fields) []uintptr {
+	keys := make([]string, 0, len(data))
+	for k, v := range data {
+		if _, ok := v.(error); ok && k != logrus.ErrorKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := data[logrus.ErrorKey].(error); ok {
+		keys = append([]string{logrus.ErrorKey}, keys...)
+	}
+	for _, k := range keys {
+		var pcs []uintptr
+		for err := data[k].(error); err != nil; err = errors.Unwrap(err) {
+			if s, ok := stackTrace(err); ok {
+				pcs = s
+			}
+		}
+		if pcs != nil {
+			return pcs
+		}
+	}
+	return nil
+}
+
+// stackTrace returns the program counters of the StackTrace method of err,
+// eg: github.com/pkg/errors
+func stackTrace(err error) ([]uintptr, bool) {
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil, false
+	}
+	v := m.Call(nil)[0]
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uintptr || v.Len() == 0 {
+		return nil, false
+	}
+	pcs := make([]uintptr, v.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(v.Index(i).Uint())
+	}
+	return pcs, true
+}
+
+// stackLines returns the frames as lines
+// eg: controllers/aibf/character.go:99 aibf.(*Character).Load
+func stackLines(stack []runtime.Frame) []string {
+	lines := make([]string, len(stack))
+	for i, frame := range stack {
+		lines[i] = frame.File + ":" + strconv.Itoa(frame.Line) + " " + path.Base(frame.Function)
+	}
+	return lines
+}
+
+// appendStack appends the stack of entry as the indented lines
+func appendStack(b *bytes.Buffer, entry *logrus.Entry) {
+	for _, line := range stackLines(getStack(entry)) {
+		b.WriteString("\n\t")
+		b.WriteString(line)
+	}
+}
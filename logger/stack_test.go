@@ -0,0 +1,130 @@
+package logger_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/log"
+	"github.com/tengattack/tgo/logger"
+)
+
+// stackError is an error carrying its own stack like github.com/pkg/errors
+type stackError struct {
+	error
+	pcs []uintptr
+}
+
+func (e *stackError) StackTrace() []uintptr {
+	return e.pcs
+}
+
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return &stackError{error: errors.New(msg), pcs: pcs[:n]}
+}
+
+func TestStackTrace(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "error.log")
+	conf := &log.Config{
+		Format:      "string",
+		AccessLog:   filepath.Join(dir, "access.log"),
+		AccessLevel: "info",
+		ErrorLog:    path,
+		ErrorLevel:  "warn",
+		StackLevel:  "error",
+	}
+	assert.NoError(conf.Validate())
+	l, err := logger.New("logger", conf)
+	assert.NoError(err)
+
+	l.Warn("no stack")
+	l.Error("stack")
+	stackErr := newStackError("bar")
+	l.WithField("error", fmt.Errorf("foo: %w", stackErr)).Error("error stack")
+	assert.NoError(l.Close(context.Background()))
+
+	content, err := os.ReadFile(filepath.Join(dir, "access.log"))
+	assert.NoError(err)
+	assert.Regexp(`^\S+ \[warning\] \[stack_test\.go:\d+\] no stack\n$`, string(content))
+
+	content, err = os.ReadFile(path)
+	assert.NoError(err)
+	// the stack lines are indented
+	var entries []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		if strings.HasPrefix(line, "\t") && len(entries) > 0 {
+			entries[len(entries)-1] += "\n" + line
+		} else {
+			entries = append(entries, line)
+		}
+	}
+	if assert.Len(entries, 2) {
+		stack := strings.Split(entries[0], "\n\t")
+		if assert.True(len(stack) > 2, entries[0]) {
+			assert.Regexp(`\[error\] \[stack_test\.go:\d+\] stack$`, stack[0])
+			assert.Regexp(`^stack_test\.go:\d+ logger_test\.TestStackTrace$`, stack[1])
+			assert.Regexp(`testing\.go:\d+ testing\.tRunner$`, stack[len(stack)-1])
+		}
+		stack = strings.Split(entries[1], "\n\t")
+		if assert.True(len(stack) > 2, entries[1]) {
+			// the stack of the wrapped error
+			assert.Regexp(`^stack_test\.go:\d+ logger_test\.newStackError$`, stack[1])
+			assert.Regexp(`^stack_test\.go:\d+ logger_test\.TestStackTrace$`, stack[2])
+		}
+	}
+
+	// the stack is a separate field of json
+	jsonPath := filepath.Join(dir, "json.log")
+	l, err = logger.New("logger", &log.Config{
+		Format:      "json",
+		AccessLevel: "info",
+		ErrorLog:    jsonPath,
+		ErrorLevel:  "error",
+		StackLevel:  "error",
+	})
+	assert.NoError(err)
+	l.WithField("error", stackErr).Error("json")
+	assert.NoError(l.Close(context.Background()))
+	content, err = os.ReadFile(jsonPath)
+	assert.NoError(err)
+	var data map[string]interface{}
+	assert.NoError(json.Unmarshal(content, &data))
+	assert.Regexp(`^stack_test\.go:\d+ logger_test\.newStackError\n`, data["stack_trace"])
+	assert.Equal("json", data["msg"])
+
+	// the stack is a quoted field of logfmt, with the frames limited by the
+	// stack depth of the logger
+	logfmtPath := filepath.Join(dir, "logfmt.log")
+	l, err = logger.New("logger", &log.Config{
+		Format:      "logfmt",
+		AccessLevel: "info",
+		ErrorLog:    logfmtPath,
+		ErrorLevel:  "error",
+		StackLevel:  "error",
+		StackDepth:  1,
+	})
+	assert.NoError(err)
+	l.Error("logfmt")
+	assert.NoError(l.Close(context.Background()))
+	content, err = os.ReadFile(logfmtPath)
+	assert.NoError(err)
+	assert.Regexp(` msg=logfmt stack_trace="stack_test\.go:\d+ logger_test\.TestStackTrace"\n$`, string(content))
+
+	// invalid stack level and depth
+	conf.StackLevel = "fine"
+	conf.StackDepth = -1
+	err = conf.Validate()
+	assert.ErrorContains(err, "stack_level")
+	assert.ErrorContains(err, "stack_depth")
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	stdlog "log"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKeySource is the field of the prefix of the standard library logger
+const FieldKeySource = "source"
+
+// stdLogWriter is the output of the standard library logger, which strips
+// the prefix and header of each line and logs the message with the caller of
+// the standard library logger, the prefix is kept as the source field
+type stdLogWriter struct {
+	level  logrus.Level
+	logger *stdlog.Logger
+}
+
+// RedirectStdLog redirects the output of the standard library global logger
+// to this package with the level, call the returned function to restore it
+func RedirectStdLog(level logrus.Level) (restore func()) {
+	out, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	stdlog.SetOutput(&stdLogWriter{level: level, logger: stdlog.Default()})
+	return func() {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}
+}
+
+// NewStdLogger returns a standard library logger logs to this package with
+// the level, eg: used as http.Server.ErrorLog
+func NewStdLogger(level logrus.Level) *stdlog.Logger {
+	w := &stdLogWriter{level: level}
+	w.logger = stdlog.New(w, "", 0)
+	return w.logger
+}
+
+// Write logs a line written by the standard library logger
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	l := LogAccess
+	if w.level <= logrus.ErrorLevel {
+		l = LogError
+	}
+	if l == nil {
+		return len(p), nil
+	}
+
+	prefix := w.logger.Prefix()
+	msg, file, line := parseStdLog(string(p), w.logger.Flags(), prefix)
+	entry := logrus.NewEntry(l)
+	if source := stdLogSource(prefix); source != "" {
+		entry = entry.WithField(FieldKeySource, source)
+	}
+	if frame, ok := stdLogCaller(); ok {
+		setCallFrame(entry, frame.File, frame.Line)
+	} else if file != "" {
+		setCallFrame(entry, file, line)
+	}
+	if !levelEnabled(entry, w.level) {
+		return len(p), nil
+	}
+	entry.Log(w.level, msg)
+	return len(p), nil
+}
+
+// parseStdLog strips the prefix and header from the line by the flags of the
+// standard library logger, it returns the message and the file and line in
+// the header if any
+// eg: prefix: 2009/01/23 01:23:23.123123 /a/b/c/d.go:23: message
+func parseStdLog(s string, flags int, prefix string) (msg string, file string, line int) {
+	s = strings.TrimSuffix(s, "\n")
+	if flags&stdlog.Lmsgprefix == 0 {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	if flags&stdlog.Ldate != 0 && len(s) >= 11 {
+		s = s[11:]
+	}
+	if flags&(stdlog.Ltime|stdlog.Lmicroseconds) != 0 {
+		n := 9
+		if flags&stdlog.Lmicroseconds != 0 {
+			n = 16
+		}
+		if len(s) >= n {
+			s = s[n:]
+		}
+	}
+	if flags&(stdlog.Lshortfile|stdlog.Llongfile) != 0 {
+		if i := strings.Index(s, ": "); i >= 0 {
+			header := s[:i]
+			s = s[i+2:]
+			if j := strings.LastIndexByte(header, ':'); j >= 0 {
+				file = header[:j]
+				line, _ = strconv.Atoi(header[j+1:])
+			}
+		}
+	}
+	if flags&stdlog.Lmsgprefix != 0 {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	return s, file, line
+}
+
+// stdLogSource returns the source of the prefix,
+// eg: "[lib] " -> "lib", "http: " -> "http"
+func stdLogSource(prefix string) string {
+	return strings.Trim(prefix, " :[]")
+}
+
+// stdLogCaller returns the first frame outside the standard library logger
+func stdLogCaller() (runtime.Frame, bool) {
+	var pcs [16]uintptr
+	// skip runtime.Callers, stdLogCaller and stdLogWriter.Write
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") {
+			return frame, frame.Function != ""
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package logger_test
+
+import (
+	"bytes"
+	stdlog "log"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/logger"
+)
+
+func TestRedirectStdLog(t *testing.T) {
+	assert := assert.New(t)
+	access, errorLog := &bytes.Buffer{}, &bytes.Buffer{}
+	logger.LogAccess = logrus.New()
+	logger.LogAccess.Out = access
+	logger.LogAccess.Formatter = logger.NewLogFileFormatter("tgo")
+	logger.LogError = logrus.New()
+	logger.LogError.Out = errorLog
+	logger.LogError.Formatter = logger.NewLogFileFormatter("tgo")
+
+	restore := logger.RedirectStdLog(logrus.WarnLevel)
+	stdlog.SetFlags(stdlog.LstdFlags | stdlog.Lmicroseconds | stdlog.Lshortfile)
+	stdlog.SetPrefix("[lib] ")
+	stdlog.Printf("foo %d", 1)
+	restore()
+	assert.Regexp(`^\S+ \[warning\] \[\S*stdlog_test\.go:\d+\] foo 1 source=lib\n$`, access.String())
+
+	l := logger.NewStdLogger(logrus.ErrorLevel)
+	l.SetPrefix("http: ")
+	l.SetFlags(stdlog.Lmsgprefix)
+	l.Println("bar")
+	assert.Regexp(`^\S+ \[error\] \[\S*stdlog_test\.go:\d+\] bar source=http\n$`, errorLog.String())
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trace field keys
+const (
+	FieldKeyTraceID    = "trace_id"
+	FieldKeySpanID     = "span_id"
+	FieldKeyTraceFlags = "trace_flags"
+)
+
+// NewTraceContext returns a copy of ctx with a generated trace id if ctx
+// carries no span, it is used to correlate the logs of background jobs, so
+// call it once at the start of the job and log with the returned context
+func NewTraceContext(ctx context.Context) context.Context {
+	if trace.SpanContextFromContext(ctx).HasTraceID() {
+		return ctx
+	}
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+	}))
+}
+
+// traceExtractor extracts the trace fields from the span in context
+func traceExtractor(ctx context.Context) Fields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return nil
+	}
+	fields := Fields{
+		FieldKeyTraceID: sc.TraceID().String(),
+	}
+	// the trace id generated by NewTraceContext has no span
+	if sc.HasSpanID() {
+		fields[FieldKeySpanID] = sc.SpanID().String()
+		fields[FieldKeyTraceFlags] = sc.TraceFlags().String()
+	}
+	return fields
+}
+
+// isTraceField checks whether the key is one of the trace field keys
+func isTraceField(key string) bool {
+	return key == FieldKeyTraceID || key == FieldKeySpanID || key == FieldKeyTraceFlags
+}
@@ -0,0 +1,60 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/tgo/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceFields(t *testing.T) {
+	assert := assert.New(t)
+	b := &bytes.Buffer{}
+	logger.LogAccess = logrus.New()
+	logger.LogAccess.Out = b
+	logger.LogAccess.Formatter = logger.NewLogstashFormatter(logrus.Fields{"app_id": "tgo"})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	logger.Ctx(ctx).Info("foo")
+
+	var data map[string]interface{}
+	assert.NoError(json.Unmarshal(b.Bytes(), &data))
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", data["trace_id"])
+	assert.Equal("00f067aa0ba902b7", data["span_id"])
+	assert.Equal("01", data["trace_flags"])
+	assert.NotContains(data["message"], "trace_id")
+
+	// the trace id generated for the context without span is kept
+	b.Reset()
+	logger.LogAccess.Formatter = logger.NewLogFileFormatter("tgo")
+	ctx = logger.NewTraceContext(context.Background())
+	logger.Ctx(ctx).Info("foo")
+	logger.Ctx(ctx).Info("bar")
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if assert.Len(lines, 2) {
+		assert.Regexp(` foo trace_id=([0-9a-f]{32})$`, lines[0])
+		assert.Equal(lines[0][strings.Index(lines[0], "trace_id="):], lines[1][strings.Index(lines[1], "trace_id="):])
+	}
+
+	// no trace id is generated by Ctx
+	b.Reset()
+	logger.Ctx(context.Background()).Info("foo")
+	assert.NotContains(b.String(), "trace_id")
+
+	// no trace fields without context
+	b.Reset()
+	logger.Info("foo")
+	assert.NotContains(b.String(), "trace_id")
+}